@@ -0,0 +1,271 @@
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// itemCollectionPaths are the collections the backends create when saving an item that has them set.
+var itemCollectionPaths = vocab.CollectionPaths{
+	vocab.Inbox,
+	vocab.Outbox,
+	vocab.Followers,
+	vocab.Following,
+	vocab.Liked,
+	vocab.Likes,
+	vocab.Shares,
+	vocab.Replies,
+}
+
+// collectionProperty returns the property of the item which corresponds to the "path" collection,
+// or nil if the item doesn't have such a property.
+func collectionProperty(it vocab.Item, path vocab.CollectionPath) *vocab.Item {
+	var prop *vocab.Item
+	if vocab.ActorTypes.Match(it.GetType()) {
+		_ = vocab.OnActor(it, func(act *vocab.Actor) error {
+			switch path {
+			case vocab.Inbox:
+				prop = &act.Inbox
+			case vocab.Outbox:
+				prop = &act.Outbox
+			case vocab.Followers:
+				prop = &act.Followers
+			case vocab.Following:
+				prop = &act.Following
+			case vocab.Liked:
+				prop = &act.Liked
+			case vocab.Likes:
+				prop = &act.Likes
+			case vocab.Shares:
+				prop = &act.Shares
+			case vocab.Replies:
+				prop = &act.Replies
+			}
+			return nil
+		})
+		return prop
+	}
+	_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+		switch path {
+		case vocab.Likes:
+			prop = &ob.Likes
+		case vocab.Shares:
+			prop = &ob.Shares
+		case vocab.Replies:
+			prop = &ob.Replies
+		}
+		return nil
+	})
+	return prop
+}
+
+const pathChars = "abcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// randomCollectionIRI returns an IRI on the host of "owner", with a random path that has none of
+// the structure of the usual collection IRIs.
+func randomCollectionIRI(rnd *rand.Rand, owner vocab.IRI) vocab.IRI {
+	u, err := owner.URL()
+	if err != nil {
+		return owner.AddPath(fmt.Sprintf("%x", rnd.Uint64()))
+	}
+	segments := make([]string, 1+rnd.IntN(4))
+	for i := range segments {
+		seg := make([]byte, 4+rnd.IntN(12))
+		for j := range seg {
+			seg[j] = pathChars[rnd.IntN(len(pathChars))]
+		}
+		segments[i] = string(seg)
+	}
+	return vocab.IRI(fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, strings.Join(segments, "/")))
+}
+
+// withRandomCollections sets all the collection properties of the item to random IRIs.
+func (r *runner) withRandomCollections(it vocab.Item) vocab.Item {
+	for _, path := range itemCollectionPaths {
+		if prop := collectionProperty(it, path); prop != nil {
+			*prop = randomCollectionIRI(r.rand, it.GetLink())
+		}
+	}
+	return it
+}
+
+// testItemCollection verifies that the "colIRI" collection of the owner item got created when saving it,
+// and that it is empty.
+func testItemCollection(t *check, storage ActivityPubStorage, owner vocab.Item, colIRI vocab.IRI) vocab.CollectionInterface {
+	t.Helper()
+
+	loadedCol, err := storage.Load(colIRI)
+	if err != nil {
+		t.Fatalf("unable to load %s collection %s: %s", owner.GetType(), colIRI, err)
+	}
+	if vocab.IsNil(loadedCol) || !allCollectionTypes.Match(loadedCol.GetType()) {
+		t.Fatalf("invalid %T collection type, expected %v", loadedCol, allCollectionTypes)
+	}
+
+	var result vocab.CollectionInterface
+	err = vocab.OnCollectionIntf(loadedCol, func(col vocab.CollectionInterface) error {
+		if !col.GetLink().Equal(colIRI) {
+			t.Errorf("invalid %s collection returned from loading %s: %s", owner.GetType(), colIRI, col.GetLink())
+		}
+		if len(col.Collection()) != 0 {
+			t.Errorf("freshly created collection should have zero items, found %d", len(col.Collection()))
+		}
+		if col.Count() != 0 {
+			t.Errorf("freshly created collection should have zero total items, found %d", col.Count())
+		}
+		result = col
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("invalid %T collection type, expected %v", loadedCol, allCollectionTypes)
+	}
+	return result
+}
+
+// testCreateItemCollections saves actors and objects which have collections with the standard names,
+// and with random paths, and checks that all of them get created the same way.
+func (r *runner) testCreateItemCollections(t *testing.T) {
+	owners := []struct {
+		name string
+		item vocab.Item
+	}{
+		{name: "actor", item: gen.RandomActor(gen.Root)},
+		{name: "object", item: gen.RandomObject(gen.Root)},
+		{name: "actor with random collection IRIs", item: r.withRandomCollections(gen.RandomActor(gen.Root))},
+		{name: "object with random collection IRIs", item: r.withRandomCollections(gen.RandomObject(gen.Root))},
+	}
+
+	for _, owner := range owners {
+		r.run(t, owner.name, func(t *testing.T) {
+			r.parallel(t)
+			storage := mockActivityPub(t, r.newStorage)
+			mockItems(t, storage, owner.item)
+
+			for _, path := range itemCollectionPaths {
+				prop := collectionProperty(owner.item, path)
+				if prop == nil || vocab.IsNil(*prop) {
+					continue
+				}
+				colIRI := (*prop).GetLink()
+				r.require(t, fmt.Sprintf("%s %s", path, colIRI), reqAPSaveCollections, func(t *check) {
+					testItemCollection(t, storage, owner.item, colIRI)
+				})
+				r.require(t, fmt.Sprintf("%s owner", path), reqAPSaveCollectionsOwner, func(t *check) {
+					col := testItemCollection(t, storage, owner.item, colIRI)
+					_ = vocab.OnObject(col, func(ob *vocab.Object) error {
+						if vocab.IsNil(ob.AttributedTo) || !ob.AttributedTo.GetLink().Equal(owner.item.GetLink()) {
+							t.Errorf("collection %s should be attributed to %s, got %v", colIRI, owner.item.GetLink(), ob.AttributedTo)
+						}
+						return nil
+					})
+				})
+			}
+		})
+	}
+}
+
+// testHiddenCollections blocks and ignores random actors by adding them to the hidden collections of an actor,
+// which don't exist before the first items get added to them.
+func (r *runner) testHiddenCollections(t *testing.T) {
+	actor := gen.RandomActor(gen.Root)
+	hidden := []struct {
+		path  vocab.CollectionPath
+		items vocab.ItemCollection
+	}{
+		{path: filters.BlockedType},
+		{path: filters.IgnoredType},
+	}
+	for i := range hidden {
+		for range 4 {
+			hidden[i].items = append(hidden[i].items, gen.RandomActor(gen.Root))
+		}
+	}
+
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
+	requireBehaviour(t, storage, CapabilityHiddenCollections)
+	mockItems(t, storage, actor)
+	for _, h := range hidden {
+		mockItems(t, storage, h.items...)
+	}
+
+	for _, h := range hidden {
+		colIRI := h.path.IRI(actor)
+		r.require(t, fmt.Sprintf("add to %s", colIRI), reqAPHiddenCreate, func(t *check) {
+			if err := storage.AddTo(colIRI, h.items...); err != nil {
+				t.Fatalf("unable to add items to %s: %s", colIRI, err)
+			}
+			loadedCol, err := storage.Load(colIRI)
+			if err != nil {
+				t.Fatalf("unable to load %s collection %s: %s", h.path, colIRI, err)
+			}
+			err = vocab.OnCollectionIntf(loadedCol, func(col vocab.CollectionInterface) error {
+				if col.Count() != uint(len(h.items)) {
+					t.Errorf("%s collection should have %d total items, found %d", h.path, len(h.items), col.Count())
+				}
+				for _, it := range h.items {
+					if !col.Contains(it) {
+						t.Errorf("%s collection doesn't contain %s", h.path, it.GetLink())
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("invalid %T collection type, expected %v", loadedCol, allCollectionTypes)
+			}
+		})
+	}
+
+	for _, h := range hidden {
+		colIRI := h.path.IRI(actor)
+		first := h.items.First().GetLink()
+		r.require(t, fmt.Sprintf("filter %s", colIRI), reqAPHiddenFilter, func(t *check) {
+			tests := []struct {
+				name   string
+				checks filters.Checks
+				want   int
+			}{
+				{name: "same ID", checks: filters.Checks{filters.SameID(first)}, want: 1},
+				{name: "not same ID", checks: filters.Checks{filters.Not(filters.SameID(first))}, want: len(h.items) - 1},
+				{name: "first page", checks: filters.Checks{filters.WithMaxCount(1)}, want: 1},
+			}
+			for _, tt := range tests {
+				loadedCol, err := storage.Load(colIRI, tt.checks...)
+				if err != nil {
+					t.Errorf("unable to load %s collection %s with %s filter: %s", h.path, colIRI, tt.name, err)
+					continue
+				}
+				if got := len(collectionItems(loadedCol)); got != tt.want {
+					t.Errorf("%s collection loaded with %s filter should have %d items, found %d", h.path, tt.name, tt.want, got)
+				}
+			}
+		})
+	}
+
+	r.require(t, "reload actor", reqAPHiddenNotExposed, func(t *check) {
+		loaded, err := storage.Load(actor.GetLink())
+		if err != nil {
+			t.Fatalf("unable to load actor %s: %s", actor.GetLink(), err)
+		}
+		if !cmp.Equal(actor, loaded) {
+			t.Errorf("actor changed after adding items to its hidden collections: %s", cmp.Diff(actor, loaded))
+		}
+		raw, err := vocab.MarshalJSON(loaded)
+		if err != nil {
+			t.Fatalf("unable to marshal actor %s: %s", actor.GetLink(), err)
+		}
+		for _, h := range hidden {
+			if colIRI := h.path.IRI(actor); bytes.Contains(raw, []byte(colIRI)) {
+				t.Errorf("actor %s exposes its hidden %s collection %s", actor.GetLink(), h.path, colIRI)
+			}
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package conformance
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/go-ap/storage-conformance-suite/gen"
+)
+
+// dereferenced returns copies of the activities, with their actors, objects and targets replaced
+// with the corresponding items, which is what the backends need to apply the filters on.
+func dereferenced(activities vocab.ItemCollection, items vocab.ItemCollection) vocab.ItemCollection {
+	byIRI := make(map[vocab.IRI]vocab.Item, len(items))
+	for _, it := range items {
+		byIRI[it.GetLink()] = it
+	}
+	load := func(it vocab.Item) vocab.Item {
+		if vocab.IsIRI(it) {
+			if ob, ok := byIRI[it.GetLink()]; ok {
+				return ob
+			}
+		}
+		return it
+	}
+
+	result := make(vocab.ItemCollection, 0, len(activities))
+	for _, it := range activities {
+		_ = vocab.OnActivity(it, func(act *vocab.Activity) error {
+			clone := *act
+			clone.Actor = load(clone.Actor)
+			clone.Object = load(clone.Object)
+			clone.Target = load(clone.Target)
+			result = append(result, &clone)
+			return nil
+		})
+	}
+	return result
+}
+
+// testDereferencing saves flattened activities, whose actors, objects and targets are IRIs, and loads a collection
+// containing them with filters on the properties of their actors, objects and targets.
+func (r *runner) testDereferencing(t *testing.T) {
+	actors := make(vocab.ItemCollection, 0)
+	for range 3 {
+		actors = append(actors, gen.RandomActor(gen.Root))
+	}
+	objects := make(vocab.ItemCollection, 0)
+	for range 4 {
+		objects = append(objects, gen.RandomObject(gen.Root))
+	}
+	activities := make(vocab.ItemCollection, 0)
+	for i := range 12 {
+		act := gen.RandomNonNonContentActivity(objects[i%len(objects)].GetLink(), actors[i%len(actors)])
+		_ = vocab.OnActivity(act, func(act *vocab.Activity) error {
+			act.Target = objects[(i+1)%len(objects)].GetLink()
+			return nil
+		})
+		activities = append(activities, act)
+	}
+	col := newCollection()
+
+	queries := make([]filterQuery, 0)
+	for _, actor := range actors {
+		name := actor.(*vocab.Actor).Name.String()
+		queries = append(queries, filterQuery{
+			name:   fmt.Sprintf("actor name is %q", name),
+			checks: filters.Checks{filters.Actor(filters.NameIs(name))},
+		})
+	}
+	types := make([]vocab.ActivityVocabularyType, 0)
+	for _, ob := range objects {
+		if typ, ok := itemType(ob); ok && !slices.Contains(types, typ) {
+			types = append(types, typ)
+		}
+	}
+	for _, typ := range types {
+		queries = append(queries,
+			filterQuery{name: fmt.Sprintf("object type %s", typ), checks: filters.Checks{filters.Object(filters.HasType(typ))}},
+			filterQuery{name: fmt.Sprintf("target type %s", typ), checks: filters.Checks{filters.Target(filters.HasType(typ))}},
+		)
+	}
+	if len(types) > 0 {
+		name := actors[0].(*vocab.Actor).Name.String()
+		queries = append(queries, filterQuery{
+			name: fmt.Sprintf("actor name is %q and object type %s", name, types[0]),
+			checks: filters.Checks{
+				filters.All(filters.Actor(filters.NameIs(name)), filters.Object(filters.HasType(types[0]))),
+			},
+		})
+	}
+
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
+	requireBehaviour(t, storage, CapabilityFilterPushdown)
+	mockItems(t, storage, actors...)
+	mockItems(t, storage, objects...)
+	mockItems(t, storage, activities...)
+	mockCollection(t, storage, col, activities...)
+
+	expected := newestFirst(dereferenced(activities, slices.Concat(actors, objects)))
+	for _, q := range queries {
+		r.require(t, q.name, reqAPDereference, func(t *check) {
+			loaded, err := storage.Load(col.GetLink(), q.checks...)
+			if err != nil {
+				t.Fatalf("unable to load collection %s: %s", col.GetLink(), err)
+			}
+			filtered, ok := q.checks.Run(expected).(vocab.ItemCollection)
+			if !ok {
+				t.Fatalf("filtered items are not compatible with an Item Collection")
+			}
+			want, got := itemIDs(filtered), itemIDs(collectionItems(loaded))
+			if !slices.Equal(want, got) {
+				t.Errorf("invalid items returned from loading with dereferenced filters, expected %v, got %v", want, got)
+			}
+		})
+	}
+}
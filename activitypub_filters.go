@@ -0,0 +1,182 @@
+package conformance
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/go-ap/storage-conformance-suite/gen"
+)
+
+// publishedBetween is a check matching the items published in the [from, to) interval.
+// The filters package doesn't have a check for publishing dates, so it requires [CapabilityCustomChecks].
+type publishedBetween struct {
+	from, to time.Time
+}
+
+func (p publishedBetween) Match(it vocab.Item) bool {
+	match := false
+	_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+		match = !ob.Published.Before(p.from) && ob.Published.Before(p.to)
+		return nil
+	})
+	return match
+}
+
+// filterQuery is a named combination of filters for loading a collection.
+type filterQuery struct {
+	name   string
+	checks filters.Checks
+	// custom is set when the checks include ones which are not part of the filters package.
+	custom bool
+}
+
+// filterAtom is one of the checks the filter matrix gets combined from.
+type filterAtom struct {
+	name  string
+	check filters.Check
+	// custom is set when the check is, or includes, one which is not part of the filters package.
+	custom bool
+}
+
+func (a filterAtom) not() filterAtom {
+	return filterAtom{name: fmt.Sprintf("not(%s)", a.name), check: filters.Not(a.check), custom: a.custom}
+}
+
+func allOf(atoms ...filterAtom) filterAtom {
+	return combine("all", filters.All, atoms...)
+}
+
+func anyOf(atoms ...filterAtom) filterAtom {
+	return combine("any", filters.Any, atoms...)
+}
+
+func combine(name string, fn func(...filters.Check) filters.Check, atoms ...filterAtom) filterAtom {
+	names := make([]string, 0, len(atoms))
+	checks := make([]filters.Check, 0, len(atoms))
+	custom := false
+	for _, a := range atoms {
+		names = append(names, a.name)
+		checks = append(checks, a.check)
+		custom = custom || a.custom
+	}
+	return filterAtom{name: fmt.Sprintf("%s(%s)", name, strings.Join(names, ", ")), check: fn(checks...), custom: custom}
+}
+
+func itemType(it vocab.Item) (vocab.ActivityVocabularyType, bool) {
+	for _, typ := range vocab.Types {
+		if typ.Match(it.GetType()) {
+			return typ, true
+		}
+	}
+	return "", false
+}
+
+// randomWord returns a random one of the words of the natural language values.
+func (r *runner) randomWord(values vocab.NaturalLanguageValues) string {
+	words := strings.Fields(values.String())
+	if len(words) == 0 {
+		return ""
+	}
+	return words[r.rand.IntN(len(words))]
+}
+
+// buildFilterAtoms builds checks from the values of random items of the collection, so most of them
+// match some of its items.
+func (r *runner) buildFilterAtoms(items vocab.ItemCollection) []filterAtom {
+	atoms := make([]filterAtom, 0)
+	if len(items) == 0 {
+		return atoms
+	}
+	random := func() vocab.Item {
+		return items[r.rand.IntN(len(items))]
+	}
+
+	if typ, ok := itemType(random()); ok {
+		atoms = append(atoms, filterAtom{name: fmt.Sprintf("type %s", typ), check: filters.HasType(typ)})
+	}
+	atoms = append(atoms, filterAtom{name: fmt.Sprintf("attributedTo %s", gen.RootID), check: filters.SameAttributedTo(gen.RootID)})
+	id := random().GetLink()
+	atoms = append(atoms, filterAtom{name: fmt.Sprintf("id %s", id), check: filters.SameID(id)})
+
+	var name, nameWord, contentWord string
+	published := make([]time.Time, 0, len(items))
+	for _, it := range items {
+		_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+			if name == "" && len(ob.Name) > 0 && r.rand.IntN(2) == 0 {
+				name, nameWord = ob.Name.String(), r.randomWord(ob.Name)
+			}
+			if contentWord == "" && len(ob.Content) > 0 && r.rand.IntN(2) == 0 {
+				contentWord = r.randomWord(ob.Content)
+			}
+			if !ob.Published.IsZero() {
+				published = append(published, ob.Published)
+			}
+			return nil
+		})
+	}
+	if name != "" {
+		atoms = append(atoms, filterAtom{name: fmt.Sprintf("name is %q", name), check: filters.NameIs(name)})
+	}
+	if nameWord != "" {
+		atoms = append(atoms, filterAtom{name: fmt.Sprintf("name like %q", nameWord), check: filters.NameLike(nameWord)})
+	}
+	if contentWord != "" {
+		atoms = append(atoms, filterAtom{name: fmt.Sprintf("content like %q", contentWord), check: filters.ContentLike(contentWord)})
+	}
+	if len(published) > 1 {
+		slices.SortFunc(published, func(a, b time.Time) int {
+			return a.Compare(b)
+		})
+		from := r.rand.IntN(len(published) - 1)
+		to := from + 1 + r.rand.IntN(len(published)-from-1)
+		p := publishedBetween{from: published[from], to: published[to]}
+		atoms = append(atoms, filterAtom{
+			name:   fmt.Sprintf("published between %s and %s", p.from.Format(time.RFC3339), p.to.Format(time.RFC3339)),
+			check:  p,
+			custom: true,
+		})
+	}
+	return atoms
+}
+
+// buildFilterMatrix combines the checks built from the items of the collection with All, Any and Not filters,
+// and returns every combination, without and with pagination.
+func (r *runner) buildFilterMatrix(items vocab.ItemCollection) []filterQuery {
+	atoms := r.buildFilterAtoms(items)
+
+	combined := make([]filterAtom, 0)
+	for i, a := range atoms {
+		combined = append(combined, a, a.not())
+		for _, b := range atoms[i+1:] {
+			combined = append(combined,
+				allOf(a, b),
+				anyOf(a, b),
+				allOf(a, b.not()),
+				anyOf(a.not(), b),
+			)
+		}
+	}
+	if len(atoms) > 2 {
+		for range len(atoms) {
+			a, b, c := atoms[r.rand.IntN(len(atoms))], atoms[r.rand.IntN(len(atoms))], atoms[r.rand.IntN(len(atoms))]
+			combined = append(combined, anyOf(allOf(a, b), c.not()), allOf(anyOf(a, b), c))
+		}
+	}
+
+	sizes := r.conf.queryPageSizes()
+	queries := make([]filterQuery, 0, 2*len(combined))
+	for _, c := range combined {
+		queries = append(queries, filterQuery{name: c.name, checks: filters.Checks{c.check}, custom: c.custom})
+		size := sizes[r.rand.IntN(len(sizes))]
+		queries = append(queries, filterQuery{
+			name:   fmt.Sprintf("%s, max items %d", c.name, size),
+			checks: filters.Checks{c.check, filters.WithMaxCount(size)},
+			custom: c.custom,
+		})
+	}
+	return queries
+}
@@ -0,0 +1,144 @@
+package conformance
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// onHost is a check matching the items whose IRIs are on the "host" host.
+// It requires [CapabilityCustomChecks].
+type onHost struct {
+	host string
+}
+
+func (h onHost) Match(it vocab.Item) bool {
+	if vocab.IsNil(it) {
+		return false
+	}
+	u, err := it.GetLink().URL()
+	return err == nil && strings.EqualFold(u.Host, h.host)
+}
+
+// hostOf returns the host of the IRI, including its port.
+func hostOf(iri vocab.IRI) string {
+	u, err := iri.URL()
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// testMultipleHosts saves local actors, together with actors from the remote hosts in [gen.RemoteHosts], and
+// the activities they published. It loads them back, adds local and remote items to the collections of
+// actors from both, and loads a collection containing all the activities, filtered by their actors and hosts.
+func (r *runner) testMultipleHosts(t *testing.T) {
+	local := vocab.ItemCollection{gen.RandomActor(gen.Root), gen.RandomActor(gen.Root)}
+	remote := make(vocab.ItemCollection, 0)
+	for _, host := range gen.RemoteHosts {
+		for range 3 {
+			remote = append(remote, gen.RandomRemoteActor(host))
+		}
+	}
+	actors := slices.Concat(local, remote)
+	objects := make(vocab.ItemCollection, 0, len(actors))
+	activities := make(vocab.ItemCollection, 0, len(actors))
+	for _, actor := range actors {
+		ob := gen.RandomObject(actor)
+		objects = append(objects, ob)
+		activities = append(activities, gen.CreateActivity(ob.GetLink(), actor))
+	}
+	inbox := newCollection()
+	localCol := gen.RandomCollection(local[0])
+	remoteCol := gen.RandomCollection(remote[0])
+
+	localHost := hostOf(gen.DefaultHost)
+	hosts := []string{localHost}
+	for _, host := range gen.RemoteHosts {
+		hosts = append(hosts, hostOf(host))
+	}
+	remoteActor := remote[r.rand.IntN(len(remote))]
+	queries := []filterQuery{
+		{name: fmt.Sprintf("attributed to local actor %s", local[0].GetLink()), checks: filters.Checks{filters.SameAttributedTo(local[0].GetLink())}},
+		{name: fmt.Sprintf("attributed to remote actor %s", remoteActor.GetLink()), checks: filters.Checks{filters.SameAttributedTo(remoteActor.GetLink())}},
+		{name: fmt.Sprintf("actor is remote actor %s", remoteActor.GetLink()), checks: filters.Checks{filters.Actor(filters.SameID(remoteActor.GetLink()))}},
+		{name: "not on the local host", checks: filters.Checks{filters.Not(onHost{host: localHost})}, custom: true},
+	}
+	for _, host := range hosts {
+		queries = append(queries,
+			filterQuery{name: fmt.Sprintf("on host %s", host), checks: filters.Checks{onHost{host: host}}, custom: true},
+			filterQuery{name: fmt.Sprintf("actor on host %s", host), checks: filters.Checks{filters.Actor(onHost{host: host})}, custom: true},
+		)
+	}
+
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
+	mockItems(t, storage, actors...)
+	mockItems(t, storage, objects...)
+	mockItems(t, storage, activities...)
+
+	for _, host := range hosts {
+		r.require(t, fmt.Sprintf("load items from host %s", host), reqAPMultiHostLoad, func(t *check) {
+			for _, it := range slices.Concat(actors, objects, activities) {
+				if !(onHost{host: host}).Match(it) {
+					continue
+				}
+				loaded, err := storage.Load(it.GetLink())
+				if err != nil {
+					t.Errorf("unable to load %s: %s", it.GetLink(), err)
+					continue
+				}
+				if !cmp.Equal(it, loaded, equateLangRefs) {
+					t.Errorf("invalid item returned from loading %s: %s", it.GetLink(), cmp.Diff(it, loaded, equateLangRefs))
+				}
+			}
+		})
+	}
+
+	r.require(t, "add remote items to the collection of a local actor", reqAPMultiHostMembership, func(t *check) {
+		if _, err := storage.Save(localCol); err != nil {
+			t.Fatalf("unable to save collection %s: %s", localCol.GetLink(), err)
+		}
+		members := make([]vocab.IRI, 0, len(remote))
+		for _, it := range remote {
+			members = append(members, it.GetLink())
+		}
+		if err := storage.AddTo(localCol.GetLink(), remote...); err != nil {
+			t.Fatalf("unable to add remote actors to collection %s: %s", localCol.GetLink(), err)
+		}
+		testMembers(t, storage, localCol.GetLink(), members...)
+		if err := storage.RemoveFrom(localCol.GetLink(), remote[0].GetLink()); err != nil {
+			t.Fatalf("unable to remove %s from collection %s: %s", remote[0].GetLink(), localCol.GetLink(), err)
+		}
+		testMembers(t, storage, localCol.GetLink(), members[1:]...)
+	})
+
+	r.require(t, "add local items to the collection of a remote actor", reqAPMultiHostMembership, func(t *check) {
+		if _, err := storage.Save(remoteCol); err != nil {
+			t.Fatalf("unable to save collection %s: %s", remoteCol.GetLink(), err)
+		}
+		// NOTE(marius): the last remote actor is on a different host than the owner of the collection
+		items := vocab.ItemCollection{local[0].GetLink(), local[1], remote[len(remote)-1].GetLink()}
+		if err := storage.AddTo(remoteCol.GetLink(), items...); err != nil {
+			t.Fatalf("unable to add items to collection %s: %s", remoteCol.GetLink(), err)
+		}
+		testMembers(t, storage, remoteCol.GetLink(), local[0].GetLink(), local[1].GetLink(), remote[len(remote)-1].GetLink())
+	})
+
+	mockCollection(t, storage, inbox, activities...)
+	requireBehaviour(t, storage, CapabilityFilterPushdown)
+	for _, q := range queries {
+		r.require(t, fmt.Sprintf("query collection with %s", q.name), reqAPMultiHostFilter, func(t *check) {
+			if q.custom {
+				requireBehaviour(t.T, storage, CapabilityCustomChecks)
+			}
+			testCollectionQuery(t, storage, inbox.GetLink(), activities, q.checks)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package conformance
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// iriVariants is a group of IRIs which differ only in the way they are written.
+type iriVariants struct {
+	name string
+	iris []vocab.IRI
+}
+
+// equivalentIRIs returns the groups of IRIs which identify the same item, as their differences are only
+// normalizations of the same IRI: the case of the host, the default port of the scheme, a trailing slash
+// in the path, or percent-encoding of the characters in the path.
+func equivalentIRIs(path string) []iriVariants {
+	return []iriVariants{
+		{
+			name: "uppercase host",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/host"),
+				vocab.IRI("https://EXAMPLE.COM" + path + "/host"),
+				vocab.IRI("https://Example.com" + path + "/host"),
+			},
+		},
+		{
+			name: "explicit default port",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/port"),
+				vocab.IRI("https://example.com:443" + path + "/port"),
+			},
+		},
+		{
+			name: "trailing slash",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/slash"),
+				vocab.IRI("https://example.com" + path + "/slash/"),
+			},
+		},
+		{
+			name: "unicode path",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/café-ñandú-日本"),
+				vocab.IRI("https://example.com" + path + "/caf%C3%A9-%C3%B1and%C3%BA-%E6%97%A5%E6%9C%AC"),
+			},
+		},
+		{
+			name: "percent-encoded path",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/%7Euser-%E2%9C%93"),
+				vocab.IRI("https://example.com" + path + "/~user-✓"),
+				vocab.IRI("https://example.com" + path + "/%7euser-%e2%9c%93"),
+			},
+		},
+		{
+			name: "IPv6 host",
+			iris: []vocab.IRI{
+				vocab.IRI("https://[2001:db8::1]" + path),
+				vocab.IRI("https://[2001:DB8::1]" + path),
+				vocab.IRI("https://[2001:db8::1]:443" + path + "/"),
+			},
+		},
+	}
+}
+
+// distinctIRIs returns the groups of IRIs which identify different items, although they differ only in
+// their query strings, fragments, schemes, ports, the case of their paths, or their hosts.
+func distinctIRIs(path string) []iriVariants {
+	return []iriVariants{
+		{
+			name: "query strings",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/query"),
+				vocab.IRI("https://example.com" + path + "/query?page=1"),
+				vocab.IRI("https://example.com" + path + "/query?page=2"),
+				vocab.IRI("https://example.com" + path + "/query?page=1&maxItems=10"),
+			},
+		},
+		{
+			name: "fragments",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/fragment"),
+				vocab.IRI("https://example.com" + path + "/fragment#main"),
+				vocab.IRI("https://example.com" + path + "/fragment#main-key"),
+			},
+		},
+		{
+			name: "schemes and ports",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/scheme"),
+				vocab.IRI("http://example.com" + path + "/scheme"),
+				vocab.IRI("https://example.com:8443" + path + "/scheme"),
+			},
+		},
+		{
+			name: "path case",
+			iris: []vocab.IRI{
+				vocab.IRI("https://example.com" + path + "/case"),
+				vocab.IRI("https://example.com" + path + "/CASE"),
+			},
+		},
+		{
+			name: "IPv6 hosts",
+			iris: []vocab.IRI{
+				vocab.IRI("https://[2001:db8::2]" + path),
+				vocab.IRI("https://[2001:db8::3]" + path),
+				vocab.IRI("https://[2001:db8::2]:8443" + path),
+			},
+		},
+	}
+}
+
+// objectWithID returns a random object, with its ID set to "iri".
+func objectWithID(iri vocab.IRI) vocab.Item {
+	it := gen.RandomObject(gen.Root)
+	_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+		ob.ID = iri
+		return nil
+	})
+	return it
+}
+
+// testLoadVariant loads the item by one of the variants of its IRI, and verifies that it is the saved item,
+// with its IRI written the way it was saved.
+func testLoadVariant(t *check, storage ActivityPubStorage, iri vocab.IRI, want vocab.Item) {
+	t.Helper()
+
+	loaded, err := storage.Load(iri)
+	if err != nil {
+		t.Errorf("unable to load %s, saved as %s: %s", iri, want.GetLink(), err)
+		return
+	}
+	if loaded.GetLink() != want.GetLink() {
+		t.Errorf("invalid item returned from loading %s: %s, expected %s", iri, loaded.GetLink(), want.GetLink())
+		return
+	}
+	if !cmp.Equal(want, loaded, equateLangRefs) {
+		t.Errorf("invalid item returned from loading %s: %s", iri, cmp.Diff(want, loaded, equateLangRefs))
+	}
+}
+
+// testIRIVariants saves items with IRIs containing unicode and percent-encoded characters, query strings,
+// fragments, trailing slashes, uppercase hosts, explicit ports and IPv6 hosts. The ones which are
+// normalizations of the same IRI must load the same item, the other ones must load different items.
+func (r *runner) testIRIVariants(t *testing.T) {
+	path := strings.TrimPrefix(gen.RandomObject(gen.Root).GetLink().String(), gen.DefaultHost.String())
+	equivalent, distinct := equivalentIRIs(path), distinctIRIs(path)
+	objects := make(map[string]vocab.ItemCollection)
+	for _, group := range equivalent {
+		objects[group.name] = vocab.ItemCollection{objectWithID(group.iris[0])}
+	}
+	for _, group := range distinct {
+		for _, iri := range group.iris {
+			objects[group.name] = append(objects[group.name], objectWithID(iri))
+		}
+	}
+
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
+
+	for _, group := range equivalent {
+		r.require(t, fmt.Sprintf("load equivalent IRIs: %s", group.name), reqAPIRIEquivalent, func(t *check) {
+			// NOTE(marius): only the item with the first IRI of the group gets saved, and it must be
+			// returned when loading it by any of the other ones
+			saved := objects[group.name][0]
+			if _, err := storage.Save(saved); err != nil {
+				t.Fatalf("unable to save %s: %s", saved.GetLink(), err)
+			}
+			for _, iri := range group.iris {
+				testLoadVariant(t, storage, iri, saved)
+			}
+		})
+	}
+
+	for _, group := range distinct {
+		r.require(t, fmt.Sprintf("load distinct IRIs: %s", group.name), reqAPIRIDistinct, func(t *check) {
+			for _, it := range objects[group.name] {
+				if _, err := storage.Save(it); err != nil {
+					t.Fatalf("unable to save %s: %s", it.GetLink(), err)
+				}
+			}
+			for _, it := range objects[group.name] {
+				testLoadVariant(t, storage, it.GetLink(), it)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
+)
+
+// nameInLanguage is a check matching the items which have the "value" name in the "lang" language.
+// It requires [CapabilityCustomChecks].
+type nameInLanguage struct {
+	lang  vocab.LangRef
+	value string
+}
+
+func (n nameInLanguage) Match(it vocab.Item) bool {
+	match := false
+	_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+		_, ok := ob.Name[n.lang]
+		match = ok && string(ob.Name.Get(n.lang)) == n.value
+		return nil
+	})
+	return match
+}
+
+// testNaturalLanguageValues compares the values of every language of the natural language properties,
+// so the error messages show which of them got mangled.
+func testNaturalLanguageValues(t *check, prop string, want, got vocab.NaturalLanguageValues) {
+	t.Helper()
+
+	for lang, value := range want {
+		if _, ok := got[lang]; !ok {
+			t.Errorf("%s value in language %q is missing, expected %q", prop, language.Tag(lang), value)
+			continue
+		}
+		if loaded := got.Get(lang); !bytes.Equal(value, loaded) {
+			t.Errorf("invalid %s value in language %q: %q, expected %q", prop, language.Tag(lang), loaded, value)
+		}
+	}
+	for lang, value := range got {
+		if _, ok := want[lang]; !ok {
+			t.Errorf("unexpected %s value in language %q: %q", prop, language.Tag(lang), value)
+		}
+	}
+}
+
+// testMultilingualItems saves objects whose names, summaries and content have values in multiple languages,
+// loads them back, and loads a collection containing them with filters on the values of their names
+// in specific languages.
+func (r *runner) testMultilingualItems(t *testing.T) {
+	objects := make(vocab.ItemCollection, 0)
+	for range 8 {
+		objects = append(objects, gen.RandomMultilingualObject(gen.Root))
+	}
+	col := newCollection()
+
+	queries := make([]filterQuery, 0)
+	for _, it := range objects {
+		_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+			for lang, value := range ob.Name {
+				if lang == vocab.DefaultLang {
+					continue
+				}
+				queries = append(queries,
+					filterQuery{name: fmt.Sprintf("name is %q", value), checks: filters.Checks{filters.NameIs(string(value))}},
+					filterQuery{
+						name:   fmt.Sprintf("name in %q is %q", language.Tag(lang), value),
+						checks: filters.Checks{nameInLanguage{lang: lang, value: string(value)}},
+						custom: true,
+					},
+				)
+			}
+			return nil
+		})
+	}
+	// NOTE(marius): the map iteration order is random, so the queries need to be sorted for getting
+	// the same ones with the same seed
+	slices.SortFunc(queries, func(a, b filterQuery) int {
+		return strings.Compare(a.name, b.name)
+	})
+	queries = slices.CompactFunc(queries, func(a, b filterQuery) bool {
+		return a.name == b.name
+	})
+	if len(queries) > 6 {
+		start := r.rand.IntN(len(queries) - 6)
+		queries = queries[start : start+6]
+	}
+
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
+
+	for _, it := range objects {
+		r.require(t, fmt.Sprintf("round trip %s", it.GetLink()), reqAPNaturalLanguage, func(t *check) {
+			if _, err := storage.Save(it); err != nil {
+				t.Fatalf("unable to save %s: %s", it.GetLink(), err)
+			}
+			loaded, err := storage.Load(it.GetLink())
+			if err != nil {
+				t.Fatalf("unable to load %s: %s", it.GetLink(), err)
+			}
+			err = vocab.OnObject(it, func(want *vocab.Object) error {
+				return vocab.OnObject(loaded, func(got *vocab.Object) error {
+					testNaturalLanguageValues(t, "name", want.Name, got.Name)
+					testNaturalLanguageValues(t, "summary", want.Summary, got.Summary)
+					testNaturalLanguageValues(t, "content", want.Content, got.Content)
+					return nil
+				})
+			})
+			if err != nil {
+				t.Errorf("invalid %T item returned from loading %s: %s", loaded, it.GetLink(), err)
+			}
+			if !cmp.Equal(it, loaded, equateLangRefs) {
+				t.Errorf("invalid item returned from loading %s", cmp.Diff(it, loaded, equateLangRefs))
+			}
+		})
+	}
+
+	mockItems(t, storage, objects...)
+	mockCollection(t, storage, col, objects...)
+	requireBehaviour(t, storage, CapabilityFilterPushdown)
+	for _, q := range queries {
+		r.require(t, fmt.Sprintf("query collection with %s", q.name), reqAPNaturalLanguageFilter, func(t *check) {
+			if q.custom {
+				requireBehaviour(t.T, storage, CapabilityCustomChecks)
+			}
+			testCollectionQuery(t, storage, col.GetLink(), objects, q.checks)
+		})
+	}
+}
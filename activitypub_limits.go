@@ -0,0 +1,239 @@
+package conformance
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// The names of the limits recorded in the report by the size boundary tests.
+const (
+	limitContentSize = "content size"
+	limitAttachments = "attachments"
+	limitIRILength   = "collection IRI length"
+)
+
+// The sizes every storage needs to accept. Larger items can be rejected, as long as the storage
+// returns an error, without panicking and without storing a different item.
+const (
+	baselineContentSize = 64 << 10
+	baselineAttachments = 64
+	baselineIRILength   = 512
+)
+
+// sizeRequirement returns the requirement verified by saving an item of "size", depending on whether
+// it's larger than the "baseline" every storage needs to accept.
+func sizeRequirement(size, baseline int) Requirement {
+	if size > baseline {
+		return reqAPSizeLimitsLarge
+	}
+	return reqAPSizeLimits
+}
+
+// recovered executes fn, and returns the value it panicked with, if any.
+func recovered(fn func()) (p any) {
+	defer func() {
+		p = recover()
+	}()
+	fn()
+	return nil
+}
+
+// randomContent returns base64 encoded random data of exactly "size" bytes, which is the same for the same seed.
+func randomContent(seed uint64, size int) string {
+	rnd := rand.New(rand.NewPCG(seed, uint64(size)))
+	raw := make([]byte, (base64.StdEncoding.DecodedLen(size)/8+2)*8)
+	for i := 0; i < len(raw); i += 8 {
+		binary.LittleEndian.PutUint64(raw[i:], rnd.Uint64())
+	}
+	return base64.StdEncoding.EncodeToString(raw)[:size]
+}
+
+// longIRI appends path segments of up to 64 characters to "base", until the IRI is "length" characters long.
+func longIRI(base vocab.IRI, length int) vocab.IRI {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+	s := strings.Builder{}
+	s.WriteString(strings.TrimRight(base.String(), "/"))
+	for i := 0; s.Len() < length; i++ {
+		if remaining := length - s.Len(); remaining > 1 {
+			s.WriteByte('/')
+		}
+		seg := min(64, length-s.Len())
+		for j := range seg {
+			s.WriteByte(chars[(i+j)%len(chars)])
+		}
+	}
+	return vocab.IRI(s.String())
+}
+
+// saveProbe saves the item, and loads it back. It returns false if the storage rejected it.
+// The storage is allowed to reject the item with an error, but it must not panic, and it must not
+// store a different item than the one it received.
+func saveProbe(t *check, storage ActivityPubStorage, it vocab.Item) bool {
+	t.Helper()
+
+	var err error
+	if p := recovered(func() { _, err = storage.Save(it) }); p != nil {
+		t.Fatalf("saving %s panicked: %v", it.GetLink(), p)
+	}
+	var loaded vocab.Item
+	var loadErr error
+	if p := recovered(func() { loaded, loadErr = storage.Load(it.GetLink()) }); p != nil {
+		t.Fatalf("loading %s panicked: %v", it.GetLink(), p)
+	}
+	if err != nil {
+		t.Logf("unable to save %s: %s", it.GetLink(), err)
+		if loadErr == nil && !vocab.IsNil(loaded) && !cmp.Equal(it, loaded, equateLangRefs) {
+			t.Errorf("item %s was rejected by the storage, but a different item got stored", it.GetLink())
+		}
+		return false
+	}
+	if loadErr != nil {
+		t.Fatalf("unable to load %s: %s", it.GetLink(), loadErr)
+	}
+	// NOTE(marius): the diffs of the items are as large as the items, so we only report that they differ
+	if !cmp.Equal(it, loaded, equateLangRefs) {
+		t.Fatalf("invalid item returned from loading %s, it doesn't correspond to the saved one", it.GetLink())
+	}
+	return true
+}
+
+// recordLimit records in the report that the storage accepted an item of "size" for the "name" limit.
+func (r *runner) recordLimit(t *testing.T, name string, size int) {
+	t.Helper()
+
+	t.Logf("accepted %s %d", name, size)
+	if r.report != nil {
+		r.report.recordLimit(name, size)
+	}
+}
+
+// testSizeLimits saves objects with increasingly larger content, and with more attachments, and collections
+// with increasingly longer IRIs. After the storage rejects an item, the larger ones are skipped.
+func (r *runner) testSizeLimits(t *testing.T) {
+	seed := r.rand.Uint64()
+	contentSizes := r.conf.contentSizes()
+	attachmentCounts := r.conf.attachmentCounts()
+	documents := make(vocab.ItemCollection, 0, len(contentSizes))
+	for range contentSizes {
+		documents = append(documents, gen.RandomObjectByType(gen.Root, vocab.DocumentType))
+	}
+	attached := make(vocab.ItemCollection, 0, len(attachmentCounts))
+	for range attachmentCounts {
+		attached = append(attached, gen.RandomObject(gen.Root))
+	}
+	// NOTE(marius): the IRIs can't be shorter than the ones of the collections they get built from,
+	// so we skip the lengths under that
+	iriLengths := make([]int, 0)
+	collections := make([]vocab.CollectionInterface, 0)
+	for _, length := range r.conf.iriLengths() {
+		col := gen.RandomCollection(gen.Root)
+		if length < len(col.GetLink()) {
+			continue
+		}
+		iriLengths = append(iriLengths, length)
+		collections = append(collections, col)
+	}
+
+	r.parallel(t)
+
+	r.run(t, "content size", func(t *testing.T) {
+		storage := mockActivityPub(t, r.newStorage)
+		rejected := 0
+		for i, size := range contentSizes {
+			r.require(t, fmt.Sprintf("save %d bytes of content", size), sizeRequirement(size, baselineContentSize), func(t *check) {
+				if rejected > 0 {
+					t.Skipf("the storage rejected %d bytes of content", rejected)
+				}
+				it := documents[i]
+				_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+					ob.MediaType = "application/octet-stream"
+					ob.Content = vocab.DefaultNaturalLanguage(randomContent(seed, size))
+					return nil
+				})
+				if !saveProbe(t, storage, it) {
+					rejected = size
+					if size <= baselineContentSize {
+						t.Errorf("the storage rejected %d bytes of content, it needs to accept up to %d", size, baselineContentSize)
+					}
+					return
+				}
+				r.recordLimit(t.T, limitContentSize, size)
+			})
+		}
+	})
+
+	r.run(t, "attachments", func(t *testing.T) {
+		storage := mockActivityPub(t, r.newStorage)
+		rejected := 0
+		for i, cnt := range attachmentCounts {
+			r.require(t, fmt.Sprintf("save %d attachments", cnt), sizeRequirement(cnt, baselineAttachments), func(t *check) {
+				if rejected > 0 {
+					t.Skipf("the storage rejected %d attachments", rejected)
+				}
+				it := attached[i]
+				_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+					attachments := make(vocab.ItemCollection, 0, cnt)
+					for j := range cnt {
+						attachments = append(attachments, ob.ID.AddPath("attachments", strconv.Itoa(j)))
+					}
+					ob.Attachment = attachments
+					return nil
+				})
+				if !saveProbe(t, storage, it) {
+					rejected = cnt
+					if cnt <= baselineAttachments {
+						t.Errorf("the storage rejected %d attachments, it needs to accept up to %d", cnt, baselineAttachments)
+					}
+					return
+				}
+				r.recordLimit(t.T, limitAttachments, cnt)
+			})
+		}
+	})
+
+	r.run(t, "collection IRI length", func(t *testing.T) {
+		storage := mockActivityPub(t, r.newStorage)
+		rejected := 0
+		for i, length := range iriLengths {
+			r.require(t, fmt.Sprintf("save collection with IRI of %d characters", length), sizeRequirement(length, baselineIRILength), func(t *check) {
+				if rejected > 0 {
+					t.Skipf("the storage rejected a collection IRI of %d characters", rejected)
+				}
+				col := collections[i]
+				_ = vocab.OnObject(col, func(ob *vocab.Object) error {
+					ob.ID = longIRI(ob.ID, length)
+					return nil
+				})
+				if !saveProbe(t, storage, col) {
+					rejected = length
+					if length <= baselineIRILength {
+						t.Errorf("the storage rejected a collection IRI of %d characters, it needs to accept up to %d", length, baselineIRILength)
+					}
+					return
+				}
+				prefix := col.GetLink()[:min(64, len(col.GetLink()))]
+				if err := storage.AddTo(col.GetLink(), gen.RootID); err != nil {
+					t.Fatalf("unable to add %s to collection %s...: %s", gen.RootID, prefix, err)
+				}
+				loaded, err := storage.Load(col.GetLink())
+				if err != nil {
+					t.Fatalf("unable to load collection %s...: %s", prefix, err)
+				}
+				if !collectionItems(loaded).Contains(gen.RootID) {
+					t.Errorf("collection %s... doesn't contain %s after adding it", prefix, gen.RootID)
+				}
+				r.recordLimit(t.T, limitIRILength, length)
+			})
+		}
+	})
+}
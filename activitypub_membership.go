@@ -0,0 +1,119 @@
+package conformance
+
+import (
+	"slices"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testMembers loads the collection, and verifies that its items and total items count correspond to the
+// "members" IRIs, in any order.
+func testMembers(t *check, storage ActivityPubStorage, colIRI vocab.IRI, members ...vocab.IRI) vocab.ItemCollection {
+	t.Helper()
+
+	loaded, err := storage.Load(colIRI)
+	if err != nil {
+		t.Errorf("unable to load collection %s: %s", colIRI, err)
+		return nil
+	}
+	if count, ok := totalItems(loaded); ok && count != uint(len(members)) {
+		t.Errorf("invalid total items count of collection %s %d, expected %d", colIRI, count, len(members))
+	}
+	items := collectionItems(loaded)
+	want, got := make([]string, 0, len(members)), itemIDs(items)
+	for _, iri := range members {
+		want = append(want, iri.String())
+	}
+	slices.Sort(want)
+	slices.Sort(got)
+	if !slices.Equal(want, got) {
+		t.Errorf("invalid items of collection %s, expected %v, got %v", colIRI, want, got)
+	}
+	return items
+}
+
+// testCollectionMembership adds items to a collection more than once, as IRIs and as full objects,
+// removes items which are not in it, and tries to add items to, and remove them from, an item which
+// is not a collection. Every check works on its own collection, so it doesn't depend on the other ones.
+func (r *runner) testCollectionMembership(t *testing.T, shared dataset) {
+	data := r.partition(shared)
+	missing := gen.RandomObject(gen.Root)
+	addTwice, addIRI, removeMissing, removeIRI := newCollection(), newCollection(), newCollection(), newCollection()
+
+	r.parallel(t)
+	if len(data.objects) < 2 {
+		t.Skipf("the collection edge cases need at least two items, the suite has %d", len(data.objects))
+	}
+	first, second := data.objects[0], data.objects[1]
+
+	storage := mockActivityPub(t, r.newStorage)
+	mockItems(t, storage, data.objects...)
+	mockCollection(t, storage, addTwice)
+	mockCollection(t, storage, addIRI, first)
+	mockCollection(t, storage, removeMissing, first, second)
+	mockCollection(t, storage, removeIRI, first, second)
+
+	r.require(t, "add the same item twice", reqAPCollectionAddIdempotent, func(t *check) {
+		colIRI := addTwice.GetLink()
+		for range 2 {
+			if err := storage.AddTo(colIRI, first); err != nil {
+				t.Fatalf("unable to add %s to collection %s: %s", first.GetLink(), colIRI, err)
+			}
+		}
+		if err := storage.AddTo(colIRI, first.GetLink()); err != nil {
+			t.Fatalf("unable to add the IRI %s to collection %s: %s", first.GetLink(), colIRI, err)
+		}
+		testMembers(t, storage, colIRI, first.GetLink())
+	})
+
+	r.require(t, "add an item by its IRI", reqAPCollectionAddIRI, func(t *check) {
+		colIRI := addIRI.GetLink()
+		if err := storage.AddTo(colIRI, second.GetLink()); err != nil {
+			t.Fatalf("unable to add the IRI %s to collection %s: %s", second.GetLink(), colIRI, err)
+		}
+		for _, it := range testMembers(t, storage, colIRI, first.GetLink(), second.GetLink()) {
+			if it.GetLink().Equal(second.GetLink()) && !vocab.IsIRI(it) && !cmp.Equal(second, it) {
+				t.Errorf("item %s of collection %s added by IRI should be returned as an IRI, or as the saved item: %s",
+					second.GetLink(), colIRI, cmp.Diff(second, it))
+			}
+		}
+	})
+
+	r.require(t, "remove items which are not in the collection", reqAPCollectionRemoveIdempotent, func(t *check) {
+		colIRI := removeMissing.GetLink()
+		if err := storage.RemoveFrom(colIRI, missing, missing.GetLink()); err != nil {
+			t.Errorf("unable to remove %s, which is not in collection %s: %s", missing.GetLink(), colIRI, err)
+		}
+		testMembers(t, storage, colIRI, first.GetLink(), second.GetLink())
+	})
+
+	r.require(t, "remove an item by its IRI", reqAPCollectionRemoveIRI, func(t *check) {
+		colIRI := removeIRI.GetLink()
+		if err := storage.RemoveFrom(colIRI, first.GetLink()); err != nil {
+			t.Errorf("unable to remove the IRI %s from collection %s: %s", first.GetLink(), colIRI, err)
+		}
+		testMembers(t, storage, colIRI, second.GetLink())
+	})
+
+	r.require(t, "add to and remove from an item which is not a collection", reqAPCollectionNotCollection, func(t *check) {
+		if err := storage.AddTo(first.GetLink(), second); !errors.IsBadRequest(err) {
+			t.Errorf("adding to %s %s, which is not a collection, should return a bad request error, got %v",
+				first.GetType(), first.GetLink(), err)
+		}
+		if err := storage.RemoveFrom(first.GetLink(), second); !errors.IsBadRequest(err) {
+			t.Errorf("removing from %s %s, which is not a collection, should return a bad request error, got %v",
+				first.GetType(), first.GetLink(), err)
+		}
+		loaded, err := storage.Load(first.GetLink())
+		if err != nil {
+			t.Fatalf("unable to load %s: %s", first.GetLink(), err)
+		}
+		if !cmp.Equal(first, loaded) {
+			t.Errorf("%s %s should not be modified by adding items to it: %s", first.GetType(), first.GetLink(), cmp.Diff(first, loaded))
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package conformance
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/go-ap/storage-conformance-suite/gen"
+)
+
+// newestFirst returns the items in the order an OrderedCollection returns them after they have been added
+// to it in the order of "items": the most recently added item first.
+func newestFirst(items vocab.ItemCollection) vocab.ItemCollection {
+	result := slices.Clone(items)
+	slices.Reverse(result)
+	return result
+}
+
+// walkPages follows the pages of "size" items of the collection, and returns their items in order.
+func walkPages(t *check, storage ActivityPubStorage, colIRI vocab.IRI, size, total int) vocab.ItemCollection {
+	t.Helper()
+
+	items := make(vocab.ItemCollection, 0, total)
+	checks := filters.Checks{filters.WithMaxCount(size)}
+	for range total/size + 2 {
+		page := loadPage(t, storage, colIRI, checks, total)
+		if page == nil {
+			break
+		}
+		items = append(items, page.Collection()...)
+		next, ok := nextPageChecks(page, colIRI)
+		if !ok {
+			break
+		}
+		checks = next
+	}
+	return items
+}
+
+// testCollectionOrder adds items to an OrderedCollection, some of them one at a time and the rest in one call,
+// and checks the order in which they are returned, with and without filters and pagination.
+// It also adds them to an unordered Collection, whose items can be returned in any order.
+func (r *runner) testCollectionOrder(t *testing.T, shared dataset) {
+	data := r.partition(shared)
+	unordered := new(vocab.Collection)
+	unordered.Type = vocab.CollectionType
+	unordered.AttributedTo = gen.RootID
+	gen.SetItemID(unordered)
+	var typ vocab.ActivityVocabularyType
+	if len(data.objects) > 0 {
+		typ, _ = itemType(data.objects[r.rand.IntN(len(data.objects))])
+	}
+
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
+	mockItems(t, storage, data.objects...)
+	mockCollection(t, storage, data.col)
+	mockCollection(t, storage, unordered, data.objects...)
+
+	colIRI := data.col.GetLink()
+	half := len(data.objects) / 2
+	for _, it := range data.objects[:half] {
+		if err := storage.AddTo(colIRI, it); err != nil {
+			t.Fatalf("unable to add %s to collection %s: %s", it.GetLink(), colIRI, err)
+		}
+	}
+	if err := storage.AddTo(colIRI, data.objects[half:]...); err != nil {
+		t.Fatalf("unable to add items to collection %s: %s", colIRI, err)
+	}
+	expected := newestFirst(data.objects)
+
+	r.require(t, "ordered collection", reqAPCollectionOrder, func(t *check) {
+		loaded, err := storage.Load(colIRI)
+		if err != nil {
+			t.Fatalf("unable to load collection %s: %s", colIRI, err)
+		}
+		if want, got := itemIDs(expected), itemIDs(collectionItems(loaded)); !slices.Equal(want, got) {
+			t.Errorf("invalid order of the items of collection %s, expected %v, got %v", colIRI, want, got)
+		}
+	})
+
+	if typ != "" {
+		queries := []filterQuery{{name: fmt.Sprintf("type %s", typ), checks: filters.Checks{filters.HasType(typ)}}}
+		for _, size := range r.conf.queryPageSizes() {
+			queries = append(queries, filterQuery{
+				name:   fmt.Sprintf("type %s, max items %d", typ, size),
+				checks: filters.Checks{filters.HasType(typ), filters.WithMaxCount(size)},
+			})
+		}
+		for _, q := range queries {
+			r.require(t, fmt.Sprintf("ordered collection with filters %s", q.name), reqAPCollectionOrder, func(t *check) {
+				loaded, err := storage.Load(colIRI, q.checks...)
+				if err != nil {
+					t.Fatalf("unable to load collection %s: %s", colIRI, err)
+				}
+				filtered, ok := q.checks.Run(expected).(vocab.ItemCollection)
+				if !ok {
+					t.Fatalf("filtered items are not compatible with an Item Collection")
+				}
+				if want, got := itemIDs(filtered), itemIDs(collectionItems(loaded)); !slices.Equal(want, got) {
+					t.Errorf("invalid order of the filtered items of collection %s, expected %v, got %v", colIRI, want, got)
+				}
+			})
+		}
+	}
+
+	for _, size := range r.conf.queryPageSizes() {
+		r.require(t, fmt.Sprintf("ordered collection pages of %d items", size), reqAPCollectionOrder, func(t *check) {
+			items := walkPages(t, storage, colIRI, size, len(expected))
+			if want, got := itemIDs(expected), itemIDs(items); !slices.Equal(want, got) {
+				t.Errorf("invalid order of the items of the pages of collection %s, expected %v, got %v", colIRI, want, got)
+			}
+		})
+	}
+
+	r.require(t, "unordered collection", reqAPCollectionAdd, func(t *check) {
+		loaded, err := storage.Load(unordered.GetLink())
+		if err != nil {
+			t.Fatalf("unable to load collection %s: %s", unordered.GetLink(), err)
+		}
+		want, got := itemIDs(data.objects), itemIDs(collectionItems(loaded))
+		slices.Sort(want)
+		slices.Sort(got)
+		if !slices.Equal(want, got) {
+			t.Errorf("invalid items of the unordered collection %s, expected %v, got %v", unordered.GetLink(), want, got)
+		}
+	})
+}
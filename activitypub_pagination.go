@@ -0,0 +1,282 @@
+package conformance
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+)
+
+// loadPage loads the collection with the checks, and verifies that its total items count is the one
+// of the full collection. A negative "total" skips that verification.
+func loadPage(t *check, storage ActivityPubStorage, colIRI vocab.IRI, checks filters.Checks, total int) vocab.CollectionInterface {
+	t.Helper()
+
+	loadIt, err := storage.Load(colIRI, checks...)
+	if err != nil {
+		t.Errorf("unable to load collection %s with filters %#v: %s", colIRI, checks, err)
+		return nil
+	}
+	var page vocab.CollectionInterface
+	err = vocab.OnCollectionIntf(loadIt, func(col vocab.CollectionInterface) error {
+		page = col
+		return nil
+	})
+	if err != nil {
+		t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
+		return nil
+	}
+	if count, ok := totalItems(loadIt); ok && total >= 0 && count != uint(total) {
+		t.Errorf("invalid collection total items count returned from loading %d, expected %d", count, total)
+	}
+	return page
+}
+
+// nextPageChecks returns the filters for loading the page following "page".
+func nextPageChecks(page vocab.CollectionInterface, colIRI vocab.IRI) (filters.Checks, bool) {
+	next := filters.NextPageFromCollection(page)
+	if vocab.IsNil(next) || colIRI.Equal(next.GetLink()) {
+		return nil, false
+	}
+	checks, err := filters.FromIRI(next.GetLink())
+	return checks, err == nil
+}
+
+// prevPageChecks returns the filters for loading the page preceding "page". When the page doesn't
+// link to its previous page, it uses a "before" cursor pointing to its first item.
+func prevPageChecks(page vocab.CollectionInterface, size int) (filters.Checks, bool) {
+	var prev vocab.Item
+	switch p := page.(type) {
+	case *vocab.OrderedCollectionPage:
+		prev = p.Prev
+	case *vocab.CollectionPage:
+		prev = p.Prev
+	}
+	if !vocab.IsNil(prev) {
+		checks, err := filters.FromIRI(prev.GetLink())
+		return checks, err == nil
+	}
+	items := page.Collection()
+	if len(items) == 0 {
+		return nil, false
+	}
+	return filters.Checks{filters.Before(filters.SameID(items.First().GetLink())), filters.WithMaxCount(size)}, true
+}
+
+// checkVisits verifies that every one of the items was visited exactly once.
+func checkVisits(t *check, direction string, items vocab.ItemCollection, visits map[vocab.IRI]int) {
+	t.Helper()
+
+	for _, it := range items {
+		if cnt := visits[it.GetLink()]; cnt != 1 {
+			t.Errorf("item %s was visited %d times walking the collection %s", it.GetLink(), cnt, direction)
+		}
+		delete(visits, it.GetLink())
+	}
+	for iri, cnt := range visits {
+		t.Errorf("unexpected item %s was visited %d times walking the collection %s", iri, cnt, direction)
+	}
+}
+
+// testWalkCollection follows the pages of the collection to its end, and from there back to its start.
+func testWalkCollection(t *check, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects vocab.ItemCollection, size int) {
+	total := len(randomObjects)
+	maxPages := total/size + 2
+
+	visits := make(map[vocab.IRI]int)
+	checks := filters.Checks{filters.WithMaxCount(size)}
+	var last vocab.CollectionInterface
+	for range maxPages {
+		page := loadPage(t, storage, colIRI, checks, total)
+		if page == nil {
+			return
+		}
+		for _, it := range page.Collection() {
+			visits[it.GetLink()]++
+		}
+		last = page
+		next, ok := nextPageChecks(page, colIRI)
+		if !ok {
+			break
+		}
+		checks = next
+	}
+	checkVisits(t, "forwards", randomObjects, visits)
+
+	visits = make(map[vocab.IRI]int)
+	page := last
+	for range maxPages {
+		for _, it := range page.Collection() {
+			visits[it.GetLink()]++
+		}
+		prev, ok := prevPageChecks(page, size)
+		if !ok {
+			break
+		}
+		if page = loadPage(t, storage, colIRI, prev, total); page == nil || len(page.Collection()) == 0 {
+			break
+		}
+	}
+	checkVisits(t, "backwards", randomObjects, visits)
+}
+
+// buildCursorQueries returns a random item of the collection, and the queries using "after" and "before" cursors
+// pointing to it, alone and combined with type filters and pagination.
+func (r *runner) buildCursorQueries(randomObjects vocab.ItemCollection) (vocab.IRI, []filterQuery) {
+	if len(randomObjects) == 0 {
+		return "", nil
+	}
+	mid := randomObjects[r.rand.IntN(len(randomObjects))].GetLink()
+	after, before := filters.After(filters.SameID(mid)), filters.Before(filters.SameID(mid))
+
+	queries := []filterQuery{
+		{name: fmt.Sprintf("after %s", mid), checks: filters.Checks{after}},
+		{name: fmt.Sprintf("before %s", mid), checks: filters.Checks{before}},
+	}
+	if typ, ok := itemType(randomObjects[r.rand.IntN(len(randomObjects))]); ok {
+		queries = append(queries,
+			filterQuery{name: fmt.Sprintf("after %s, type %s", mid, typ), checks: filters.Checks{after, filters.HasType(typ)}},
+			filterQuery{name: fmt.Sprintf("before %s, type %s", mid, typ), checks: filters.Checks{before, filters.HasType(typ)}},
+		)
+	}
+	for _, size := range r.conf.queryPageSizes() {
+		queries = append(queries,
+			filterQuery{name: fmt.Sprintf("after %s, max items %d", mid, size), checks: filters.Checks{after, filters.WithMaxCount(size)}},
+			filterQuery{name: fmt.Sprintf("before %s, max items %d", mid, size), checks: filters.Checks{before, filters.WithMaxCount(size)}},
+		)
+	}
+	return mid, queries
+}
+
+// testCursorPagination loads the collection with the cursor queries, verifies that the items before and after
+// the "mid" item are complementary, and walks the pages of the collection in both directions.
+func (r *runner) testCursorPagination(t *testing.T, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects vocab.ItemCollection, mid vocab.IRI, queries []filterQuery) {
+	for _, q := range queries {
+		r.require(t, fmt.Sprintf("query collection %s", q.name), reqAPCollectionCursor, func(t *check) {
+			testCollectionQuery(t, storage, colIRI, randomObjects, q.checks)
+		})
+	}
+
+	if mid == "" {
+		return
+	}
+	r.require(t, fmt.Sprintf("split collection at %s", mid), reqAPCollectionCursor, func(t *check) {
+		visits := map[vocab.IRI]int{mid: 1}
+		for _, checks := range []filters.Checks{{filters.After(filters.SameID(mid))}, {filters.Before(filters.SameID(mid))}} {
+			if page := loadPage(t, storage, colIRI, checks, len(randomObjects)); page != nil {
+				for _, it := range page.Collection() {
+					visits[it.GetLink()]++
+				}
+			}
+		}
+		checkVisits(t, fmt.Sprintf("before and after %s", mid), randomObjects, visits)
+	})
+
+	for _, size := range r.conf.queryPageSizes() {
+		r.require(t, fmt.Sprintf("walk collection with pagination %d", size), reqAPCollectionCursor, func(t *check) {
+			testWalkCollection(t, storage, colIRI, randomObjects, size)
+		})
+	}
+}
+
+// testPaginateWhileUpdating walks the pages of the collection, while multiple goroutines keep adding the "extra"
+// items to it, and removing them. The items which were in the collection before the walk started need
+// to be visited exactly once. When the walk is done, every goroutine removes its extra items and adds back
+// the first of them, so the updates lost by the storage show up in the items the collection ends up with.
+//
+// NOTE(marius): the updates start after loading the first page, as the extra items get added at the start
+// of ordered collections, where they could otherwise end up as the cursor of the next page and disappear.
+func testPaginateWhileUpdating(t *check, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects, extra vocab.ItemCollection, size int) {
+	writers := make([]vocab.ItemCollection, min(4, len(extra)))
+	for i, it := range extra {
+		writers[i%len(writers)] = append(writers[i%len(writers)], it)
+	}
+
+	done := make(chan struct{})
+	errs := make(chan error, len(writers))
+	wg := sync.WaitGroup{}
+	update := func(items vocab.ItemCollection) error {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				if err := storage.RemoveFrom(colIRI, items...); err != nil {
+					return err
+				}
+				return storage.AddTo(colIRI, items[0])
+			default:
+			}
+			if err := storage.AddTo(colIRI, items[i%len(items)]); err != nil {
+				return err
+			}
+			if i%2 == 1 {
+				if err := storage.RemoveFrom(colIRI, items[(i-1)%len(items)]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	startUpdates := sync.OnceFunc(func() {
+		for _, items := range writers {
+			wg.Go(func() {
+				if err := update(items); err != nil {
+					errs <- err
+				}
+			})
+		}
+	})
+
+	visits := make(map[vocab.IRI]int)
+	checks := filters.Checks{filters.WithMaxCount(size)}
+	maxPages := 2*(len(randomObjects)+len(extra))/size + 2
+	for range maxPages {
+		loadIt, err := storage.Load(colIRI, checks...)
+		if err != nil {
+			t.Errorf("unable to load collection %s with filters %#v: %s", colIRI, checks, err)
+			break
+		}
+		var next filters.Checks
+		_ = vocab.OnCollectionIntf(loadIt, func(page vocab.CollectionInterface) error {
+			for _, it := range page.Collection() {
+				visits[it.GetLink()]++
+			}
+			next, _ = nextPageChecks(page, colIRI)
+			return nil
+		})
+		startUpdates()
+		if next == nil {
+			break
+		}
+		checks = next
+	}
+	startUpdates()
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unable to update collection %s during the traversal: %s", colIRI, err)
+	}
+	for _, it := range extra {
+		delete(visits, it.GetLink())
+	}
+	checkVisits(t, "during concurrent updates", randomObjects, visits)
+
+	members := make([]vocab.IRI, 0, len(randomObjects)+len(writers))
+	for _, it := range randomObjects {
+		members = append(members, it.GetLink())
+	}
+	for _, items := range writers {
+		members = append(members, items[0].GetLink())
+	}
+	testMembers(t, storage, colIRI, members...)
+
+	// NOTE(marius): the collection is shared by the walks with the other page sizes, which expect it
+	// to contain only its initial items
+	for _, items := range writers {
+		if err := storage.RemoveFrom(colIRI, items[0]); err != nil {
+			t.Errorf("unable to remove %s from collection %s: %s", items[0].GetLink(), colIRI, err)
+		}
+	}
+}
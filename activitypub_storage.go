@@ -2,6 +2,7 @@ package conformance
 
 import (
 	"fmt"
+	"slices"
 	"testing"
 
 	vocab "github.com/go-ap/activitypub"
@@ -38,6 +39,8 @@ type ActivityPubStorage interface {
 	//
 	// We create the collections https://example.com/~jdoe/inbox, https://example.com/~jdoe/outbox and
 	// "https://example.com/~jdoe/followers".
+	// * When saving an item which already exists, the backend replaces it with the new version, but it *SHOULD NOT*
+	// create, or empty, its collections: they keep their items, even if their IRIs changed in the new version.
 	Save(it vocab.Item) (vocab.Item, error)
 	// Load loads the item found at the "iri" [vocab.IRI].
 	// If iri points to a collection, the filters "f" get applied to the items of the collection.
@@ -80,7 +83,11 @@ type ActivityPubStorage interface {
 	// they need to be created if missing.
 	// These two collections are called "hidden" because they do not appear as properties on the Actor,
 	// so the only way to build their IDs is to append the paths "/blocked" and "/ignored" the Actor's ID.
+	// Items can be added as IRIs or as full objects, and adding an item which is already in the collection
+	// doesn't duplicate it. Adding items to an IRI which is not a collection returns a bad request error.
 	AddTo(colIRI vocab.IRI, items ...vocab.Item) error
+	// RemoveFrom removes items from the collection, matching them by their IRIs, and ignores the ones
+	// which are not in it.
 	RemoveFrom(colIRI vocab.IRI, items ...vocab.Item) error
 }
 
@@ -94,10 +101,12 @@ func initActivityPub(storage ActivityPubStorage) error {
 	return nil
 }
 
-func buildPaginationFilters() []filters.Checks {
-	return []filters.Checks{
-		{filters.WithMaxCount(10)},
+func buildPaginationFilters(sizes ...int) []filters.Checks {
+	checks := make([]filters.Checks, 0, len(sizes))
+	for _, size := range sizes {
+		checks = append(checks, filters.Checks{filters.WithMaxCount(size)})
 	}
+	return checks
 }
 
 func buildTypeFilters() []filters.Checks {
@@ -126,145 +135,223 @@ func buildActivityAndObjectTypeFilters() []filters.Checks {
 var (
 	byTypeFilters               = buildTypeFilters()
 	byActivityObjectTypeFilters = buildActivityAndObjectTypeFilters()
-	withPagination              = buildPaginationFilters()
 )
 
-/*
- * TODO
- *  - Make sure the tests are independent, currently collection save/query/delete are dependent on having objects saved
- *    This would make the tests have a two phase structure:
- *        1. mock the expected storage layout,
- *        2. test expectations
- *    Separate tests into different test functions.
- *  - Add collection creation tests for multiple versions:
- *      1. Expected collection names: inbox, outbox, followers, following, shares, liked, likes, (blocked, ignored).
- *      2. Random IRI paths without any structure to them.
- *  - Build a proper collection filter querying matrix
- *   * Paginate a collection: maxItems, after(, before?).
- *   * Combine Any/All filters.
- *   * Add content filters.
- */
-
-func RunActivityPubTests(t *testing.T, storage ActivityPubStorage) {
+// mockItems saves the items to storage as the first phase of a test, so the expectations
+// tested afterwards don't depend on the state left behind by other tests.
+func mockItems(t *testing.T, storage ActivityPubStorage, items ...vocab.Item) {
+	t.Helper()
+
+	for _, it := range items {
+		if _, err := storage.Save(it); err != nil {
+			t.Fatalf("unable to mock item %s: %s", it.GetLink(), err)
+		}
+	}
+}
+
+// mockCollection saves the collection to storage and adds the items to it.
+func mockCollection(t *testing.T, storage ActivityPubStorage, col vocab.CollectionInterface, items ...vocab.Item) {
+	t.Helper()
+
+	mockItems(t, storage, col)
+	if len(items) == 0 {
+		return
+	}
+	if err := storage.AddTo(col.GetLink(), items...); err != nil {
+		t.Fatalf("unable to mock items for collection %s: %s", col.GetLink(), err)
+	}
+}
+
+func mockActivityPub(t *testing.T, newStorage StorageFactory) ActivityPubStorage {
+	t.Helper()
+
+	storage := newStorage(t)
 	if err := initActivityPub(storage); err != nil {
 		t.Fatalf("unable to init ActivityPub test suite: %s", err)
 	}
+	return storage
+}
+
+func RunActivityPubTests(t *testing.T, storage ActivityPubStorage, opts ...Option) {
+	newRunner(sharedStorage(storage), opts...).start(t).runActivityPubTests(t)
+}
+
+// dataset contains the random objects and the collection an ActivityPub test works on.
+type dataset struct {
+	objects vocab.ItemCollection
+	col     vocab.CollectionInterface
+}
+
+// newDataset generates the random objects and an empty collection, which is the inbox of the "owner" actor.
+func newDataset(count int, owner vocab.IRI) dataset {
+	objects := gen.RandomItemCollection(count, gen.Root)
+	return dataset{objects: objects, col: inboxOf(owner)}
+}
+
+// inboxOf returns a new collection with the IRI of the inbox of "owner".
+func inboxOf(owner vocab.IRI) vocab.CollectionInterface {
+	col := gen.RandomCollection(gen.Root)
+	_ = vocab.OnObject(col, func(ob *vocab.Object) error {
+		// NOTE(marius): this is a corner case for the storage-fs backend which doesn't work well with collections
+		// that don't have IRIs ending in the traditional collection names (inbox, outbox, followers, etc)
+		ob.ID = vocab.Inbox.IRI(owner)
+		ob.AttributedTo = ob.AttributedTo.GetLink()
+		return nil
+	})
+	return col
+}
+
+// newCollection returns a new collection for an independent test. All the collections built by
+// [gen.RandomCollection] for the same owner have the same IRI, so it uses the inbox of a new random actor,
+// which doesn't collide with the collections of the tests running concurrently against the same storage.
+func newCollection() vocab.CollectionInterface {
+	return inboxOf(gen.RandomActor(gen.Root).GetLink())
+}
+
+// partition returns the data for an independent test. In parallel mode every test gets its own objects
+// and collection, so the tests running concurrently against the same storage don't interfere with each other.
+func (r *runner) partition(shared dataset) dataset {
+	if !r.conf.parallel {
+		return shared
+	}
+	return newDataset(len(shared.objects), gen.RandomActor(gen.Root).GetLink())
+}
+
+func (r *runner) runActivityPubTests(t *testing.T) {
+	r.parallel(t)
+
+	shared := newDataset(r.conf.objects, gen.RootID)
+
+	r.require(t, "Load Root item", reqAPLoad, func(t *check) {
+		r.parallel(t.T)
+		testLoadRoot(t, mockActivityPub(t.T, r.newStorage))
+	})
+	r.require(t, fmt.Sprintf("save %d random objects", len(shared.objects)), reqAPSave, func(t *check) {
+		data := r.partition(shared)
+		r.parallel(t.T)
+		r.testSaveObjects(t, mockActivityPub(t.T, r.newStorage), data.objects)
+	})
+	r.run(t, "round trip every type", r.testRoundTripTypes)
+	r.run(t, "multilingual natural language values", r.testMultilingualItems)
+	r.run(t, "size limits", r.testSizeLimits)
+	r.run(t, "IRI variants", r.testIRIVariants)
+	r.run(t, "multiple hosts", r.testMultipleHosts)
+	nonExistentCollection := vocab.CollectionPath("non-existent").IRI(shared.objects.First())
+	r.run(t, fmt.Sprintf("operate on non-existent collection: %s", nonExistentCollection), func(t *testing.T) {
+		r.testNonExistentCollection(t, shared)
+	})
+	r.run(t, "create collection", func(t *testing.T) {
+		r.testCreateCollection(t, shared)
+	})
+	r.run(t, "create item collections", r.testCreateItemCollections)
+	r.run(t, "hidden collections", r.testHiddenCollections)
+	r.run(t, "update items", r.testUpdateItems)
+	r.run(t, "dereference properties for filters", r.testDereferencing)
+	r.require(t, fmt.Sprintf("delete %d random objects", len(shared.objects)), reqAPDelete, func(t *check) {
+		data := r.partition(shared)
+		r.parallel(t.T)
+		storage := mockActivityPub(t.T, r.newStorage)
+		mockItems(t.T, storage, data.objects...)
+
+		testDeleteObjects(t, storage, data.objects)
+	})
+	r.run(t, "delete cascades", r.testDeleteCascades)
+}
+
+func testLoadRoot(t *check, storage ActivityPubStorage) {
+	it, err := storage.Load(gen.RootID)
+	if err != nil {
+		t.Errorf("unable to load root item: %s", err)
+	}
+	if !cmp.Equal(gen.Root, it) {
+		t.Errorf("invalid root actor loaded from storage %s", cmp.Diff(gen.Root, it))
+	}
+}
 
-	// Load root item
-	t.Run("Load Root item", func(t *testing.T) {
-		it, err := storage.Load(gen.RootID)
+func (r *runner) testSaveObjects(t *check, storage ActivityPubStorage, randomObjects vocab.ItemCollection) {
+	for _, ob := range randomObjects {
+		savedIt, err := storage.Save(ob)
 		if err != nil {
-			t.Errorf("unable to load root item: %s", err)
+			t.Errorf("unable to save object: %s", err)
 		}
-		if !cmp.Equal(gen.Root, it) {
-			t.Errorf("invalid root actor loaded from storage %s", cmp.Diff(gen.Root, it))
+		if !cmp.Equal(ob, savedIt) {
+			t.Errorf("invalid object returned from saving %s", cmp.Diff(ob, savedIt))
+		}
+		loadIt, err := storage.Load(savedIt.GetLink())
+		if err != nil {
+			t.Errorf("unable to load object %s: %s", ob.GetLink(), err)
+		}
+		if !cmp.Equal(ob, loadIt) {
+			t.Errorf("invalid object returned from loading %s: %s", ob.GetLink(), cmp.Diff(ob, loadIt))
 		}
-	})
-
-	randomObjects := gen.RandomItemCollection(64, gen.Root)
-	t.Run(fmt.Sprintf("save %d random objects", len(randomObjects)), func(t *testing.T) {
-		for _, ob := range randomObjects {
-			savedIt, err := storage.Save(ob)
-			if err != nil {
-				t.Errorf("unable to save object: %s", err)
-			}
-			if !cmp.Equal(ob, savedIt) {
-				t.Errorf("invalid object returned from saving %s", cmp.Diff(ob, savedIt))
-			}
-			loadIt, err := storage.Load(savedIt.GetLink())
-			if err != nil {
-				t.Errorf("unable to load object %s: %s", ob.GetLink(), err)
-			}
-			if !cmp.Equal(ob, loadIt) {
-				t.Errorf("invalid object returned from loading %s: %s", ob.GetLink(), cmp.Diff(ob, loadIt))
-			}
 
-			// NOTE(marius): check Object and Actor collections being created:
-			// @see https://todo.sr.ht/~mariusor/go-activitypub/402
-			collectionIRISToCheck := make(vocab.IRIs, 0)
-			typ := ob.GetType()
-			if vocab.ActorTypes.Match(typ) {
-				for _, colPath := range vocab.OfActor {
-					if maybeCollection := colPath.Of(ob); !vocab.IsNil(maybeCollection) {
-						_ = collectionIRISToCheck.Append(maybeCollection.GetLink())
-					}
+		// NOTE(marius): check Object and Actor collections being created:
+		// @see https://todo.sr.ht/~mariusor/go-activitypub/402
+		collectionIRISToCheck := make(vocab.IRIs, 0)
+		typ := ob.GetType()
+		if vocab.ActorTypes.Match(typ) {
+			for _, colPath := range slices.Concat(vocab.OfActor, vocab.OfObject) {
+				if maybeCollection := colPath.Of(ob); !vocab.IsNil(maybeCollection) {
+					_ = collectionIRISToCheck.Append(maybeCollection.GetLink())
 				}
-				// //TODO(marius): this should be checked for AddTo() collections
-				//hiddenPaths := vocab.CollectionPaths{"blocked", "ignored"}
-				//for _, hiddenPath := range hiddenPaths {
-				//	_ = collectionIRISToCheck.Append(hiddenPath.IRI(ob))
-				//}
-			} else if !vocab.LinkTypes.Match(typ) {
-				for _, colPath := range vocab.OfObject {
-					if maybeCollection := colPath.Of(ob); !vocab.IsNil(maybeCollection) {
-						_ = collectionIRISToCheck.Append(maybeCollection.GetLink())
-					}
+			}
+		} else if !vocab.LinkTypes.Match(typ) {
+			for _, colPath := range vocab.OfObject {
+				if maybeCollection := colPath.Of(ob); !vocab.IsNil(maybeCollection) {
+					_ = collectionIRISToCheck.Append(maybeCollection.GetLink())
 				}
 			}
+		}
 
-			for _, itemCollection := range collectionIRISToCheck {
-				t.Run(itemCollection.String(), func(t *testing.T) {
-					_, which := vocab.Split(itemCollection)
-					t.Skipf("Checking %s skipped: we stopped creating them automatically in the storage backend", itemCollection)
-					if needsCheck := which.Of(ob); vocab.IsNil(needsCheck) {
-						return
-					}
-					loadedCol, err := storage.Load(itemCollection)
-					if err != nil {
-						t.Errorf("unable to load %s collection %s: %s", ob.GetType(), itemCollection, err)
-					}
-					err = vocab.OnCollectionIntf(loadedCol, func(col vocab.CollectionInterface) error {
-						if !col.GetLink().Equal(itemCollection) {
-							t.Errorf("invalid %s collection returned from loading %s: %s", ob.GetType(), itemCollection, loadedCol)
-						}
-						if len(col.Collection()) != 0 {
-							t.Errorf("freshly created collection should have zero items, found %d", len(col.Collection()))
-						}
-						if col.Count() != 0 {
-							t.Errorf("freshly created collection should have zero total items, found %d", col.Count())
-						}
-						return nil
-					})
-					if err != nil {
-						t.Errorf("invalid %T collection type, expected %v", loadedCol, allCollectionTypes)
-					}
-				})
-			}
+		for _, itemCollection := range collectionIRISToCheck {
+			r.require(t.T, itemCollection.String(), reqAPSaveCollections, func(t *check) {
+				testItemCollection(t, storage, ob, itemCollection)
+			})
 		}
-	})
+	}
+}
 
-	nonExistentCollection := vocab.CollectionPath("non-existent").IRI(randomObjects.First())
-	t.Run(fmt.Sprintf("operate on non-existent collection: %s", nonExistentCollection), func(t *testing.T) {
-		t.Run("RemoveFrom", func(t *testing.T) {
-			err := storage.RemoveFrom(nonExistentCollection, randomObjects...)
-			if err == nil {
-				t.Errorf("expected error on invalid collection removal")
-			}
-			if !errors.IsNotFound(err) {
-				t.Errorf("error received is not a not-found error: %s", err)
-			}
-		})
-		t.Run("AddTo", func(t *testing.T) {
-			err := storage.AddTo(nonExistentCollection, randomObjects...)
-			if err == nil {
-				t.Errorf("expected error on invalid collection removal")
-			}
-			if !errors.IsNotFound(err) {
-				t.Errorf("error received is not a not-found error: %s", err)
-			}
-		})
+func (r *runner) testNonExistentCollection(t *testing.T, shared dataset) {
+	r.require(t, "RemoveFrom", reqAPCollectionNotFound, func(t *check) {
+		data := r.partition(shared)
+		r.parallel(t.T)
+		storage := mockActivityPub(t.T, r.newStorage)
+		mockItems(t.T, storage, data.objects...)
+
+		nonExistentCollection := vocab.CollectionPath("non-existent").IRI(data.objects.First())
+		err := storage.RemoveFrom(nonExistentCollection, data.objects...)
+		if err == nil {
+			t.Errorf("expected error on invalid collection removal")
+		}
+		if !errors.IsNotFound(err) {
+			t.Errorf("error received is not a not-found error: %s", err)
+		}
 	})
+	r.require(t, "AddTo", reqAPCollectionNotFound, func(t *check) {
+		data := r.partition(shared)
+		r.parallel(t.T)
+		storage := mockActivityPub(t.T, r.newStorage)
+		mockItems(t.T, storage, data.objects...)
 
-	col := gen.RandomCollection(gen.Root)
-	_ = vocab.OnObject(col, func(ob *vocab.Object) error {
-		// NOTE(marius): this is a corner case for the storage-fs backend which doesn't work well with collections
-		// that don't have IRIs ending in the traditional collection names (inbox, outbox, followers, etc)
-		ob.ID = vocab.Inbox.IRI(ob.AttributedTo.GetLink())
-		ob.AttributedTo = ob.AttributedTo.GetLink()
-		return nil
+		nonExistentCollection := vocab.CollectionPath("non-existent").IRI(data.objects.First())
+		err := storage.AddTo(nonExistentCollection, data.objects...)
+		if err == nil {
+			t.Errorf("expected error on invalid collection removal")
+		}
+		if !errors.IsNotFound(err) {
+			t.Errorf("error received is not a not-found error: %s", err)
+		}
 	})
-	colIRI := col.GetLink()
-	t.Run("create collection", func(t *testing.T) {
+}
+
+func (r *runner) testCreateCollection(t *testing.T, shared dataset) {
+	r.require(t, "save collection", reqAPCollectionSave, func(t *check) {
+		data := r.partition(shared)
+		r.parallel(t.T)
+		col, colIRI := data.col, data.col.GetLink()
+		storage := mockActivityPub(t.T, r.newStorage)
+		mockItems(t.T, storage, data.objects...)
+
 		savedIt, err := storage.Save(col)
 		if err != nil {
 			t.Errorf("unable to save collection: %s", err)
@@ -279,156 +366,265 @@ func RunActivityPubTests(t *testing.T, storage ActivityPubStorage) {
 		if !cmp.Equal(col, loadIt) {
 			t.Errorf("invalid collection returned from loading %s: %s", colIRI, cmp.Diff(col, loadIt))
 		}
+	})
+	r.require(t, fmt.Sprintf("add %d items to collection", shared.objects.Count()), reqAPCollectionAdd, func(t *check) {
+		data := r.partition(shared)
+		r.parallel(t.T)
+		storage := mockActivityPub(t.T, r.newStorage)
+		mockItems(t.T, storage, data.objects...)
+		mockCollection(t.T, storage, data.col)
 
-		t.Run(fmt.Sprintf("add %d items to collection", randomObjects.Count()), func(t *testing.T) {
-			if err = storage.AddTo(colIRI, randomObjects...); err != nil {
-				t.Errorf("unable to add objects to collection: %s", err)
-			}
-			loadedIt, err := storage.Load(colIRI)
-			if err != nil {
-				t.Errorf("unable to load collection %s: %s", colIRI, err)
-			}
-			err = vocab.OnCollectionIntf(loadedIt, func(col vocab.CollectionInterface) error {
-				if col.Count() != uint(len(randomObjects)) {
-					t.Fatalf("invalid collection item counts returned from loading %d, expected %d", col.Count(), len(randomObjects))
-				}
-				savedItems := col.Collection()
-				if len(savedItems) != len(randomObjects) {
-					t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(savedItems), len(randomObjects))
-				}
-				gen.SortItemCollectionByID(randomObjects)
-				gen.SortItemCollectionByID(savedItems)
-				for i, it := range randomObjects {
-					if !cmp.Equal(it, savedItems[i]) {
-						t.Errorf("invalid item at pos %d, unable: %s", i, cmp.Diff(it, savedItems[i]))
-					}
-				}
-				return nil
-			})
-			if err != nil {
-				t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
-			}
-		})
-		queryFilters := append(withPagination, append(byTypeFilters, byActivityObjectTypeFilters...)...)
-		for _, fil := range queryFilters {
-			t.Run(fmt.Sprintf("query collection with filters %#v", fil), func(t *testing.T) {
-				loadIt, err := storage.Load(colIRI, fil...)
-				if err != nil {
-					t.Errorf("unable to load collection %s: %s", colIRI, err)
-				}
-				var foundItems vocab.ItemCollection
-				var totalItems uint
-				err = vocab.OnOrderedCollection(loadIt, func(col *vocab.OrderedCollection) error {
-					foundItems = col.OrderedItems
-					totalItems = col.TotalItems
-					return nil
-				})
-				if err != nil {
-					t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
-				}
-				filteredRandomObjects := fil.Run(randomObjects)
-				filteredItems, ok := filteredRandomObjects.(vocab.ItemCollection)
-				if !ok {
-					t.Fatalf("filtered items are not compatible with an Item Collection %T", filteredRandomObjects)
-				}
-				if totalItems != uint(len(randomObjects)) {
-					t.Fatalf("invalid collection total items count returned from loading %d, expected %d", totalItems, len(randomObjects))
-				}
-				if len(filteredItems) != len(foundItems) {
-					t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(foundItems), len(filteredItems))
-				}
-				if !cmp.Equal(foundItems, filteredItems /*, cmp.Comparer(vocab.ItemCollection.Equal)*/) {
-					t.Errorf("invalid items returned from loading: %s", cmp.Diff(foundItems, filteredItems /*, cmp.Comparer(vocab.ItemCollection.Equal)*/))
+		testAddToCollection(t, storage, data.col.GetLink(), data.objects)
+	})
+	r.run(t, "collection order", func(t *testing.T) {
+		r.testCollectionOrder(t, shared)
+	})
+	r.run(t, "add and remove edge cases", func(t *testing.T) {
+		r.testCollectionMembership(t, shared)
+	})
+	r.run(t, "query collection", func(t *testing.T) {
+		data := r.partition(shared)
+		r.parallel(t)
+		storage := mockActivityPub(t, r.newStorage)
+		mockItems(t, storage, data.objects...)
+		mockCollection(t, storage, data.col, data.objects...)
+		requireBehaviour(t, storage, CapabilityFilterPushdown)
+
+		r.testQueryCollection(t, storage, data.col.GetLink(), data.objects)
+	})
+	r.run(t, "query collection with filter matrix", func(t *testing.T) {
+		data := r.partition(shared)
+		queries := r.buildFilterMatrix(data.objects)
+		r.parallel(t)
+		storage := mockActivityPub(t, r.newStorage)
+		mockItems(t, storage, data.objects...)
+		mockCollection(t, storage, data.col, data.objects...)
+		requireBehaviour(t, storage, CapabilityFilterPushdown)
+
+		for _, q := range queries {
+			r.require(t, q.name, reqAPCollectionFilterMatrix, func(t *check) {
+				if q.custom {
+					requireBehaviour(t.T, storage, CapabilityCustomChecks)
 				}
+				testCollectionQuery(t, storage, data.col.GetLink(), data.objects, q.checks)
 			})
 		}
-		for idx := range len(randomObjects) + 1 {
-			cnt := idx + 1
-			checks := filters.Checks{filters.WithMaxCount(cnt)}
-			t.Run(fmt.Sprintf("traverse collection with pagination %d", cnt), func(t *testing.T) {
-				for range len(randomObjects) / cnt {
-					t.Run(fmt.Sprintf("query collection with filters %#v", checks), func(t *testing.T) {
-						loadIt, err := storage.Load(colIRI, checks...)
-						if err != nil {
-							t.Errorf("unable to load collection %s: %s", colIRI, err)
-						}
-						var foundItems vocab.ItemCollection
-						var totalItems uint
-						err = vocab.OnOrderedCollection(loadIt, func(col *vocab.OrderedCollection) error {
-							foundItems = col.OrderedItems
-							totalItems = col.TotalItems
-							return nil
-						})
-						if err != nil {
-							t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
-						}
-						filteredRandomObjects := checks.Run(randomObjects)
-						filteredItems, ok := filteredRandomObjects.(vocab.ItemCollection)
-						if !ok {
-							t.Fatalf("filtered items are not compatible with an Item Collection %T", filteredRandomObjects)
-						}
-						if totalItems != uint(len(randomObjects)) {
-							t.Fatalf("invalid collection total items count returned from loading %d, expected %d", totalItems, len(randomObjects))
-						}
-						if len(filteredItems) != len(foundItems) {
-							t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(foundItems), len(filteredItems))
-						}
-						if !cmp.Equal(foundItems, filteredItems, EquateItems) {
-							t.Errorf("invalid items returned from loading: %s", cmp.Diff(foundItems, filteredItems, EquateItems))
-						}
-						if len(filteredItems) != cnt {
-							t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(foundItems), cnt)
-						}
-						_ = vocab.OnCollectionIntf(loadIt, func(col vocab.CollectionInterface) error {
-							nextIRI := filters.NextPageFromCollection(col).GetLink()
-							if !colIRI.Equal(nextIRI) {
-								checks, _ = filters.FromIRI(nextIRI)
-							}
-							return nil
-						})
-					})
-				}
+	})
+	// NOTE(marius): the traversal tests only read the collection, but they mock it again every time,
+	// so in parallel mode they share a partition, and they don't run concurrently with each other.
+	traversal := r.partition(shared)
+	for _, cnt := range r.conf.traversalPageSizes(len(traversal.objects)) {
+		r.run(t, fmt.Sprintf("traverse collection with pagination %d", cnt), func(t *testing.T) {
+			storage := mockActivityPub(t, r.newStorage)
+			mockItems(t, storage, traversal.objects...)
+			mockCollection(t, storage, traversal.col, traversal.objects...)
+			requireBehaviour(t, storage, CapabilityFilterPushdown)
+
+			r.testTraverseCollection(t, storage, traversal.col.GetLink(), traversal.objects, cnt)
+		})
+	}
+	r.run(t, "cursor pagination", func(t *testing.T) {
+		data := r.partition(shared)
+		mid, queries := r.buildCursorQueries(data.objects)
+		r.parallel(t)
+		storage := mockActivityPub(t, r.newStorage)
+		mockItems(t, storage, data.objects...)
+		mockCollection(t, storage, data.col, data.objects...)
+		requireBehaviour(t, storage, CapabilityFilterPushdown)
+
+		r.testCursorPagination(t, storage, data.col.GetLink(), data.objects, mid, queries)
+	})
+	r.run(t, "paginate collection during concurrent updates", func(t *testing.T) {
+		data := r.partition(shared)
+		extra := gen.RandomItemCollection(max(len(data.objects)/4, 2), gen.Root)
+		r.parallel(t)
+		storage := mockActivityPub(t, r.newStorage)
+		requireBehaviour(t, storage, CapabilityConcurrency)
+		mockItems(t, storage, data.objects...)
+		mockItems(t, storage, extra...)
+		mockCollection(t, storage, data.col, data.objects...)
+
+		for _, size := range r.conf.queryPageSizes() {
+			r.require(t, fmt.Sprintf("walk collection with pagination %d", size), reqAPCollectionPaginateConcurrent, func(t *check) {
+				testPaginateWhileUpdating(t, storage, data.col.GetLink(), data.objects, extra, size)
 			})
 		}
+	})
+	r.require(t, fmt.Sprintf("remove %d items from collection", shared.objects.Count()), reqAPCollectionRemove, func(t *check) {
+		data := r.partition(shared)
+		r.parallel(t.T)
+		storage := mockActivityPub(t.T, r.newStorage)
+		mockItems(t.T, storage, data.objects...)
+		mockCollection(t.T, storage, data.col, data.objects...)
 
-		t.Run(fmt.Sprintf("remove %d items from collection", randomObjects.Count()), func(t *testing.T) {
-			if err = storage.RemoveFrom(colIRI, randomObjects...); err != nil {
-				t.Errorf("unable to remove objects from collection: %s", err)
+		testRemoveFromCollection(t, storage, data.col.GetLink(), data.objects)
+	})
+}
+
+// testAddToCollection adds the items to the collection, and checks that loading it returns all of them.
+// The order of the items is checked separately, by testCollectionOrder.
+func testAddToCollection(t *check, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects vocab.ItemCollection) {
+	if err := storage.AddTo(colIRI, randomObjects...); err != nil {
+		t.Errorf("unable to add objects to collection: %s", err)
+	}
+	loadedIt, err := storage.Load(colIRI)
+	if err != nil {
+		t.Errorf("unable to load collection %s: %s", colIRI, err)
+	}
+	err = vocab.OnCollectionIntf(loadedIt, func(col vocab.CollectionInterface) error {
+		if col.Count() != uint(len(randomObjects)) {
+			t.Fatalf("invalid collection item counts returned from loading %d, expected %d", col.Count(), len(randomObjects))
+		}
+		savedItems := col.Collection()
+		if len(savedItems) != len(randomObjects) {
+			t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(savedItems), len(randomObjects))
+		}
+		expected := append(vocab.ItemCollection{}, randomObjects...)
+		gen.SortItemCollectionByID(expected)
+		gen.SortItemCollectionByID(savedItems)
+		for i, it := range expected {
+			if !cmp.Equal(it, savedItems[i]) {
+				t.Errorf("invalid item at pos %d, unable: %s", i, cmp.Diff(it, savedItems[i]))
 			}
-			loadedIt, err := storage.Load(colIRI)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
+	}
+}
+
+func (r *runner) testQueryCollection(t *testing.T, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects vocab.ItemCollection) {
+	queryFilters := buildPaginationFilters(r.conf.queryPageSizes()...)
+	queryFilters = append(queryFilters, byTypeFilters...)
+	queryFilters = append(queryFilters, byActivityObjectTypeFilters...)
+	for _, fil := range queryFilters {
+		r.require(t, fmt.Sprintf("query collection with filters %#v", fil), reqAPCollectionFilter, func(t *check) {
+			testCollectionQuery(t, storage, colIRI, randomObjects, fil)
+		})
+	}
+}
+
+// testCollectionQuery loads the collection with the filters, and compares the result with applying the same
+// filters on the items of the collection in memory, in the order in which they were added to it.
+func testCollectionQuery(t *check, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects vocab.ItemCollection, fil filters.Checks) {
+	loadIt, err := storage.Load(colIRI, fil...)
+	if err != nil {
+		t.Errorf("unable to load collection %s: %s", colIRI, err)
+	}
+	var foundItems vocab.ItemCollection
+	var totalItems uint
+	err = vocab.OnOrderedCollection(loadIt, func(col *vocab.OrderedCollection) error {
+		foundItems = col.OrderedItems
+		totalItems = col.TotalItems
+		return nil
+	})
+	if err != nil {
+		t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
+	}
+	filteredRandomObjects := fil.Run(newestFirst(randomObjects))
+	filteredItems, ok := filteredRandomObjects.(vocab.ItemCollection)
+	if !ok {
+		t.Fatalf("filtered items are not compatible with an Item Collection %T", filteredRandomObjects)
+	}
+	if totalItems != uint(len(randomObjects)) {
+		t.Fatalf("invalid collection total items count returned from loading %d, expected %d", totalItems, len(randomObjects))
+	}
+	if len(filteredItems) != len(foundItems) {
+		t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(foundItems), len(filteredItems))
+	}
+	if !cmp.Equal(foundItems, filteredItems /*, cmp.Comparer(vocab.ItemCollection.Equal)*/) {
+		t.Errorf("invalid items returned from loading: %s", cmp.Diff(foundItems, filteredItems /*, cmp.Comparer(vocab.ItemCollection.Equal)*/))
+	}
+}
+
+func (r *runner) testTraverseCollection(t *testing.T, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects vocab.ItemCollection, cnt int) {
+	checks := filters.Checks{filters.WithMaxCount(cnt)}
+	for range len(randomObjects) / cnt {
+		r.require(t, fmt.Sprintf("query collection with filters %#v", checks), reqAPCollectionPaginate, func(t *check) {
+			loadIt, err := storage.Load(colIRI, checks...)
 			if err != nil {
 				t.Errorf("unable to load collection %s: %s", colIRI, err)
 			}
-			err = vocab.OnCollectionIntf(loadedIt, func(col vocab.CollectionInterface) error {
-				if col.Count() != 0 {
-					t.Fatalf("invalid collection item counts returned from loading %d, expected %d", col.Count(), 0)
-				}
-				if remainingItems := col.Collection(); len(remainingItems) != 0 {
-					t.Errorf("invalid collection returned from loading it has %d items: expected empty", len(remainingItems))
-					t.Logf("%s", cmp.Diff(vocab.ItemCollection{}, remainingItems))
-				}
+			var foundItems vocab.ItemCollection
+			var totalItems uint
+			err = vocab.OnOrderedCollection(loadIt, func(col *vocab.OrderedCollection) error {
+				foundItems = col.OrderedItems
+				totalItems = col.TotalItems
 				return nil
 			})
 			if err != nil {
 				t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
 			}
-		})
-	})
-
-	t.Run(fmt.Sprintf("delete %d random objects", len(randomObjects)), func(t *testing.T) {
-		for _, ob := range randomObjects {
-			if err := storage.Delete(ob); err != nil {
-				t.Errorf("unable to save object: %s", err)
+			filteredRandomObjects := checks.Run(newestFirst(randomObjects))
+			filteredItems, ok := filteredRandomObjects.(vocab.ItemCollection)
+			if !ok {
+				t.Fatalf("filtered items are not compatible with an Item Collection %T", filteredRandomObjects)
 			}
-			loadIt, err := storage.Load(ob.GetLink())
-			if err != nil && !errors.IsNotFound(err) {
-				t.Errorf("unable to load object %s: %s", ob.GetLink(), err)
+			if totalItems != uint(len(randomObjects)) {
+				t.Fatalf("invalid collection total items count returned from loading %d, expected %d", totalItems, len(randomObjects))
 			}
-			if loadIt != nil {
-				t.Errorf("invalid object returned from loading %s: it should have been empty", ob.GetLink())
+			if len(filteredItems) != len(foundItems) {
+				t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(foundItems), len(filteredItems))
 			}
+			if !cmp.Equal(foundItems, filteredItems, EquateItems) {
+				t.Errorf("invalid items returned from loading: %s", cmp.Diff(foundItems, filteredItems, EquateItems))
+			}
+			if len(filteredItems) != cnt {
+				t.Fatalf("invalid collection item counts returned from loading %d, expected %d", len(foundItems), cnt)
+			}
+			_ = vocab.OnCollectionIntf(loadIt, func(col vocab.CollectionInterface) error {
+				nextIRI := filters.NextPageFromCollection(col).GetLink()
+				if !colIRI.Equal(nextIRI) {
+					checks, _ = filters.FromIRI(nextIRI)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func testRemoveFromCollection(t *check, storage ActivityPubStorage, colIRI vocab.IRI, randomObjects vocab.ItemCollection) {
+	if err := storage.RemoveFrom(colIRI, randomObjects...); err != nil {
+		t.Errorf("unable to remove objects from collection: %s", err)
+	}
+	loadedIt, err := storage.Load(colIRI)
+	if err != nil {
+		t.Errorf("unable to load collection %s: %s", colIRI, err)
+	}
+	err = vocab.OnCollectionIntf(loadedIt, func(col vocab.CollectionInterface) error {
+		if col.Count() != 0 {
+			t.Fatalf("invalid collection item counts returned from loading %d, expected %d", col.Count(), 0)
 		}
+		if remainingItems := col.Collection(); len(remainingItems) != 0 {
+			t.Errorf("invalid collection returned from loading it has %d items: expected empty", len(remainingItems))
+			t.Logf("%s", cmp.Diff(vocab.ItemCollection{}, remainingItems))
+		}
+		return nil
 	})
+	if err != nil {
+		t.Errorf("loaded object wasn't a collection %s: %s", colIRI, err)
+	}
+}
+
+func testDeleteObjects(t *check, storage ActivityPubStorage, randomObjects vocab.ItemCollection) {
+	tombstones := tombstoneMode(storage)
+	for _, ob := range randomObjects {
+		if err := storage.Delete(ob); err != nil {
+			t.Errorf("unable to save object: %s", err)
+		}
+		loadIt, err := storage.Load(ob.GetLink())
+		if err != nil && !errors.IsNotFound(err) {
+			t.Errorf("unable to load object %s: %s", ob.GetLink(), err)
+		}
+		if tombstones {
+			testTombstone(t, loadIt, ob)
+			continue
+		}
+		if loadIt != nil {
+			t.Errorf("invalid object returned from loading %s: it should have been empty", ob.GetLink())
+		}
+	}
 }
 
 func areItems(a, b any) bool {
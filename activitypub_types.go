@@ -0,0 +1,62 @@
+package conformance
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// equateLangRefs compares language references by value, as their underlying type can have unexported fields.
+var equateLangRefs = cmp.Comparer(func(a, b vocab.LangRef) bool {
+	return a == b
+})
+
+// typedItem is an item built for one of the ActivityStreams types, or the error returned from building it.
+type typedItem struct {
+	typ  vocab.ActivityVocabularyType
+	item vocab.Item
+	err  error
+}
+
+// testRoundTripTypes saves a fully populated item of every type in [vocab.Types], and loads it back.
+func (r *runner) testRoundTripTypes(t *testing.T) {
+	owner := gen.RandomActor(gen.Root)
+	items := make([]typedItem, 0, len(vocab.Types))
+	for _, typ := range vocab.Types {
+		it, err := gen.FullItemByType(typ, owner)
+		items = append(items, typedItem{typ: typ, item: it, err: err})
+	}
+
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
+	mockItems(t, storage, owner)
+
+	for _, tt := range items {
+		r.require(t, fmt.Sprintf("round trip %s", tt.typ), reqAPRoundTrip, func(t *check) {
+			if tt.err != nil {
+				t.Skipf("unable to build an item of type %s: %s", tt.typ, tt.err)
+			}
+			saved, err := storage.Save(tt.item)
+			if err != nil {
+				t.Fatalf("unable to save %s %s: %s", tt.typ, tt.item.GetLink(), err)
+			}
+			if !cmp.Equal(tt.item, saved, equateLangRefs) {
+				t.Errorf("invalid %s returned from saving %s", tt.typ, cmp.Diff(tt.item, saved, equateLangRefs))
+			}
+			loaded, err := storage.Load(tt.item.GetLink())
+			if err != nil {
+				t.Fatalf("unable to load %s %s: %s", tt.typ, tt.item.GetLink(), err)
+			}
+			if reflect.TypeOf(loaded) != reflect.TypeOf(tt.item) {
+				t.Fatalf("invalid Go type %T returned from loading %s %s, expected %T", loaded, tt.typ, tt.item.GetLink(), tt.item)
+			}
+			if !cmp.Equal(tt.item, loaded, equateLangRefs) {
+				t.Errorf("invalid %s returned from loading %s", tt.typ, cmp.Diff(tt.item, loaded, equateLangRefs))
+			}
+		})
+	}
+}
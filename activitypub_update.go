@@ -0,0 +1,138 @@
+package conformance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// cloneItem returns a deep copy of the item, built by encoding it to JSON and decoding it back.
+func cloneItem(it vocab.Item) (vocab.Item, error) {
+	raw, err := vocab.MarshalJSON(it)
+	if err != nil {
+		return nil, err
+	}
+	return vocab.UnmarshalJSON(raw)
+}
+
+// withCollections makes sure that the item has the likes and replies collections,
+// which get checked after updating it.
+func withCollections(it vocab.Item) vocab.Item {
+	_ = vocab.OnObject(it, func(ob *vocab.Object) error {
+		if vocab.IsNil(ob.Likes) {
+			ob.Likes = vocab.Likes.IRI(ob)
+		}
+		if vocab.IsNil(ob.Replies) {
+			ob.Replies = vocab.Replies.IRI(ob)
+		}
+		return nil
+	})
+	return it
+}
+
+// updateItem returns a modified copy of the item, similar to the ones received in Update activities:
+// some of its properties are removed, its name is replaced, its Updated time is set,
+// and its replies collection gets a new IRI.
+func updateItem(it vocab.Item) (vocab.Item, error) {
+	updated, err := cloneItem(it)
+	if err != nil {
+		return nil, err
+	}
+	if vocab.ActorTypes.Match(updated.GetType()) {
+		_ = vocab.OnActor(updated, func(act *vocab.Actor) error {
+			act.PreferredUsername = vocab.DefaultNaturalLanguage(fmt.Sprintf("updated-%s", act.PreferredUsername))
+			return nil
+		})
+	}
+	err = vocab.OnObject(updated, func(ob *vocab.Object) error {
+		ob.Name = vocab.DefaultNaturalLanguage(fmt.Sprintf("Updated %s", ob.Name))
+		ob.Summary = nil
+		ob.Content = nil
+		ob.Icon = nil
+		ob.Tag = nil
+		ob.Updated = ob.Published.Add(time.Hour).UTC()
+		ob.Replies = vocab.CollectionPath("updated-replies").IRI(ob)
+		return nil
+	})
+	return updated, err
+}
+
+// testUpdateItems saves an object, an actor and an activity, and saves them again after modifying them.
+func (r *runner) testUpdateItems(t *testing.T) {
+	object := gen.RandomObject(gen.Root)
+	items := []struct {
+		name string
+		item vocab.Item
+	}{
+		{name: "object", item: withCollections(object)},
+		{name: "actor", item: withCollections(gen.RandomActor(gen.Root))},
+		{name: "activity", item: withCollections(gen.RandomNonNonContentActivity(object.GetLink(), gen.Root))},
+	}
+
+	for _, tt := range items {
+		r.run(t, tt.name, func(t *testing.T) {
+			r.parallel(t)
+			updated, err := updateItem(tt.item)
+			if err != nil {
+				t.Fatalf("unable to build the updated %s: %s", tt.item.GetType(), err)
+			}
+
+			storage := mockActivityPub(t, r.newStorage)
+			mockItems(t, storage, tt.item)
+
+			likes := vocab.Likes.Of(tt.item).GetLink()
+			if err = storage.AddTo(likes, gen.RootID); err != nil {
+				t.Fatalf("unable to add %s to the likes collection %s: %s", gen.RootID, likes, err)
+			}
+
+			r.require(t, fmt.Sprintf("update %s", tt.item.GetLink()), reqAPUpdate, func(t *check) {
+				saved, err := storage.Save(updated)
+				if err != nil {
+					t.Fatalf("unable to save updated %s: %s", tt.item.GetType(), err)
+				}
+				if !cmp.Equal(updated, saved) {
+					t.Errorf("invalid %s returned from saving the update %s", tt.item.GetType(), cmp.Diff(updated, saved))
+				}
+				loaded, err := storage.Load(updated.GetLink())
+				if err != nil {
+					t.Fatalf("unable to load updated %s %s: %s", tt.item.GetType(), updated.GetLink(), err)
+				}
+				if !cmp.Equal(updated, loaded) {
+					t.Errorf("invalid %s returned from loading the update %s", tt.item.GetType(), cmp.Diff(updated, loaded))
+				}
+			})
+
+			r.require(t, fmt.Sprintf("collections of updated %s", tt.item.GetLink()), reqAPUpdateCollections, func(t *check) {
+				// NOTE(marius): the update gets saved again, so the check doesn't depend on the previous one,
+				// which can be skipped, or not mandatory
+				if _, err := storage.Save(updated); err != nil {
+					t.Fatalf("unable to save updated %s: %s", tt.item.GetType(), err)
+				}
+				loadedCol, err := storage.Load(likes)
+				if err != nil {
+					t.Fatalf("unable to load the likes collection %s after the update: %s", likes, err)
+				}
+				err = vocab.OnCollectionIntf(loadedCol, func(col vocab.CollectionInterface) error {
+					if col.Count() != 1 || !col.Contains(gen.RootID) {
+						t.Errorf("the likes collection %s should still contain %s after the update, found %d items", likes, gen.RootID, col.Count())
+					}
+					return nil
+				})
+				if err != nil {
+					t.Errorf("invalid %T collection type, expected %v", loadedCol, allCollectionTypes)
+				}
+
+				replies := vocab.CollectionPath("updated-replies").IRI(updated)
+				if _, err = storage.Load(replies); !errors.IsNotFound(err) {
+					t.Errorf("the changed replies collection %s should not be created when updating an existing %s, got error %v",
+						replies, tt.item.GetType(), err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package conformance
+
+import (
+	"strings"
+	"testing"
+)
+
+// Capability is a feature of a storage backend, which goes beyond the basic [ActivityPubStorage] operations.
+type Capability uint32
+
+const (
+	// CapabilityKeys requires the storage to implement [KeyStorage].
+	CapabilityKeys Capability = 1 << iota
+	// CapabilityPasswords requires the storage to implement [PasswordStorage].
+	CapabilityPasswords
+	// CapabilityMetadata requires the storage to implement [MetadataStorage].
+	CapabilityMetadata
+	// CapabilityOAuth requires the storage to implement [OSINStorage].
+	CapabilityOAuth
+	// CapabilityOAuthClientSaver requires the storage to implement [ClientSaver].
+	CapabilityOAuthClientSaver
+	// CapabilityOAuthClientLister requires the storage to implement [ClientLister].
+	CapabilityOAuthClientLister
+	// CapabilityHiddenCollections requires the storage to create the hidden "blocked" and "ignored"
+	// collections of actors on demand.
+	CapabilityHiddenCollections
+	// CapabilityFilterPushdown requires the storage to apply the filters passed to Load
+	// on the items of collections, instead of leaving that to the caller.
+	CapabilityFilterPushdown
+	// CapabilityConcurrency requires the storage to be safe for concurrent use, and to keep the pages
+	// of collections consistent while other goroutines are adding and removing items.
+	CapabilityConcurrency
+	// CapabilityTombstones requires the storage to replace deleted items with [vocab.Tombstone] objects,
+	// instead of removing them. It is an alternative to the default behaviour, so it's not part of [CapabilitiesFull].
+	CapabilityTombstones
+	// CapabilityCustomChecks requires the storage to apply the [filters.Check] implementations which are not
+	// part of the filters package, like the ones the suite defines for publishing dates. Backends which translate
+	// the filters to native queries, for SQL or for key-value indexes, can't do that for checks they don't know
+	// about, unless they fall back to calling their Match method.
+	CapabilityCustomChecks
+
+	CapabilityNone Capability = 0
+
+	CapabilitiesFull = CapabilityKeys | CapabilityPasswords | CapabilityMetadata | CapabilityOAuth |
+		CapabilityOAuthClientSaver | CapabilityOAuthClientLister | CapabilityHiddenCollections | CapabilityFilterPushdown |
+		CapabilityConcurrency | CapabilityCustomChecks
+)
+
+var capabilityNames = map[Capability]string{
+	CapabilityKeys:              "keys",
+	CapabilityPasswords:         "passwords",
+	CapabilityMetadata:          "metadata",
+	CapabilityOAuth:             "oauth",
+	CapabilityOAuthClientSaver:  "oauth-client-saver",
+	CapabilityOAuthClientLister: "oauth-client-lister",
+	CapabilityHiddenCollections: "hidden-collections",
+	CapabilityFilterPushdown:    "filter-pushdown",
+	CapabilityConcurrency:       "concurrency",
+	CapabilityTombstones:        "tombstones",
+	CapabilityCustomChecks:      "custom-checks",
+}
+
+func (c Capability) String() string {
+	if c == CapabilityNone {
+		return "none"
+	}
+	names := make([]string, 0)
+	for i := range 32 {
+		cc := Capability(1 << i)
+		if c&cc != cc {
+			continue
+		}
+		if name, ok := capabilityNames[cc]; ok {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Capabilities can be implemented by a storage backend to declare which features it claims to support.
+//
+// When a backend declares a capability, the tests for it are mandatory: if the corresponding interface
+// is not implemented, or the behaviour is not correct, the tests fail.
+// The tests for capabilities that are not declared get skipped.
+//
+// Backends that don't implement Capabilities get their support guessed from the interfaces they implement.
+type Capabilities interface {
+	Capabilities() Capability
+}
+
+func declaredCapabilities(storage any) (Capability, bool) {
+	if c, ok := storage.(Capabilities); ok {
+		return c.Capabilities(), true
+	}
+	return CapabilityNone, false
+}
+
+// requireCapability skips the current test if the storage doesn't support the capability,
+// and fails it if the storage declares support for it, but "implemented" is false.
+func requireCapability(t *testing.T, storage any, c Capability, implemented bool) {
+	t.Helper()
+
+	declared, ok := declaredCapabilities(storage)
+	switch {
+	case ok && declared&c == c && !implemented:
+		t.Fatalf("storage %T declares the %s capability, but doesn't implement it", storage, c)
+	case ok && declared&c != c:
+		t.Skipf("storage %T doesn't declare the %s capability", storage, c)
+	case !implemented:
+		t.Skipf("storage %T is not compatible with %s operations", storage, c)
+	}
+}
+
+// hasCapability returns true if the storage implements the capability, and declares it, if it declares its
+// capabilities. It's for the tests which use the capability only in some of their checks, which get skipped
+// when it returns false, instead of the whole test.
+func hasCapability(storage any, c Capability, implemented bool) bool {
+	declared, ok := declaredCapabilities(storage)
+	return implemented && (!ok || declared&c == c)
+}
+
+// tombstoneMode returns true if the storage declares that it replaces deleted items with Tombstones.
+func tombstoneMode(storage any) bool {
+	declared, ok := declaredCapabilities(storage)
+	return ok && declared&CapabilityTombstones == CapabilityTombstones
+}
+
+// requireBehaviour skips the current test if the storage declares its capabilities, but not "c".
+// Behaviours don't have a corresponding interface, so for storage backends that don't implement
+// [Capabilities] the tests are always executed.
+func requireBehaviour(t *testing.T, storage any, c Capability) {
+	t.Helper()
+
+	if declared, ok := declaredCapabilities(storage); ok && declared&c != c {
+		t.Skipf("storage %T doesn't declare the %s capability", storage, c)
+	}
+}
@@ -0,0 +1,373 @@
+// Command conformance runs the storage conformance suite against local checkouts of storage backends,
+// and prints a comparison matrix of the requirements each of them passes.
+//
+// For every backend it writes a temporary go.work file which uses both the backend and the suite modules,
+// so the backend gets tested against the local copy of the suite, without touching its own go.mod or go.work.
+// The tests of the backend are executed with the "conformance" build tag, and their results are collected
+// from the JSON reports the suite writes.
+//
+// Usage:
+//
+//	go run ./cmd/conformance [flags] path/to/storage-fs path/to/storage-sqlite ...
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/version"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	conformance "github.com/go-ap/storage-conformance-suite"
+)
+
+const suiteModule = "github.com/go-ap/storage-conformance-suite"
+
+type config struct {
+	suite    string
+	out      string
+	run      string
+	race     bool
+	parallel bool
+	lenient  bool
+	online   bool
+	verbose  bool
+}
+
+func main() {
+	conf := config{}
+	flag.StringVar(&conf.suite, "suite", ".", "path to the local checkout of the conformance suite")
+	flag.StringVar(&conf.out, "out", "", "directory where the reports get written, by default a temporary one")
+	flag.StringVar(&conf.run, "run", "Conformance", "regular expression matching the names of the tests which run the suite")
+	flag.BoolVar(&conf.race, "race", false, "run the tests with the race detector enabled")
+	flag.BoolVar(&conf.parallel, "parallel", false, "run the suite in parallel mode, with concurrent calls to the backends")
+	flag.BoolVar(&conf.lenient, "lenient", false, "only log warnings for the failures of SHOULD requirements")
+	flag.BoolVar(&conf.online, "online", false, "allow the go command to download missing modules")
+	flag.BoolVar(&conf.verbose, "v", false, "print the output of all the tests, not only of the failing ones")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] backend-path...\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	code, err := run(ctx, conf, flag.Args(), os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+	os.Exit(code)
+}
+
+type backend struct {
+	name   string
+	dir    string
+	report *conformance.Report
+	failed bool
+}
+
+func run(ctx context.Context, conf config, paths []string, out io.Writer) (int, error) {
+	suiteDir, err := filepath.Abs(conf.suite)
+	if err != nil {
+		return 1, err
+	}
+	if mod, _, err := goModInfo(suiteDir); err != nil {
+		return 1, err
+	} else if mod != suiteModule {
+		return 1, fmt.Errorf("%s is not a checkout of %s, but of %s", suiteDir, suiteModule, mod)
+	}
+
+	match, err := regexp.Compile(conf.run)
+	if err != nil {
+		return 1, fmt.Errorf("invalid -run expression: %w", err)
+	}
+
+	if conf.out == "" {
+		if conf.out, err = os.MkdirTemp("", "conformance-"); err != nil {
+			return 1, err
+		}
+		defer os.RemoveAll(conf.out)
+	}
+
+	backends := make([]*backend, 0, len(paths))
+	for _, path := range paths {
+		dir, err := filepath.Abs(path)
+		if err != nil {
+			return 1, err
+		}
+		backends = append(backends, &backend{name: filepath.Base(dir), dir: dir})
+	}
+	uniqueNames(backends)
+
+	code := 0
+	for _, b := range backends {
+		if err := b.test(ctx, conf, suiteDir, match, out); err != nil {
+			return 1, fmt.Errorf("unable to run the suite for %s: %w", b.name, err)
+		}
+		if b.failed {
+			code = 1
+		}
+		if b.report == nil {
+			fmt.Fprintf(out, "No conformance report for %s, none of its tests matching %q ran the suite\n\n", b.name, conf.run)
+			code = 1
+			continue
+		}
+		if err := b.report.WriteSummary(out); err != nil {
+			return 1, err
+		}
+		fmt.Fprintln(out)
+	}
+
+	if err := writeMatrix(out, backends); err != nil {
+		return 1, err
+	}
+	return code, nil
+}
+
+// test executes every test of the backend matching the "match" expression, each one with its own report file,
+// and merges the resulting reports.
+func (b *backend) test(ctx context.Context, conf config, suiteDir string, match *regexp.Regexp, out io.Writer) error {
+	workDir, err := os.MkdirTemp(conf.out, "work-")
+	if err != nil {
+		return err
+	}
+	work, err := writeWorkspace(workDir, b.dir, suiteDir)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(), "GOWORK="+work, "GOTOOLCHAIN=local")
+	if !conf.online {
+		env = append(env, "GOPROXY=off")
+	}
+	if conf.parallel {
+		env = append(env, conformance.ParallelEnv+"=true")
+	}
+	if conf.lenient {
+		env = append(env, conformance.ModeEnv+"=lenient")
+	}
+
+	tests, err := listTests(ctx, b.dir, env)
+	if err != nil {
+		return err
+	}
+
+	reportDir := filepath.Join(conf.out, sanitize(b.name))
+	if err = os.MkdirAll(reportDir, 0o755); err != nil {
+		return err
+	}
+
+	reports := make([]*conformance.Report, 0)
+	for _, pt := range tests {
+		if !match.MatchString(pt.name) {
+			continue
+		}
+		reportPath := filepath.Join(reportDir, sanitize(pt.pkg+"."+pt.name)+".json")
+
+		args := []string{"test", "-tags", "conformance", "-count=1", "-run", "^" + regexp.QuoteMeta(pt.name) + "$"}
+		if conf.race {
+			args = append(args, "-race")
+		}
+		if conf.verbose {
+			args = append(args, "-v")
+		}
+		args = append(args, pt.pkg)
+
+		cmd := exec.CommandContext(ctx, "go", args...)
+		cmd.Dir = b.dir
+		cmd.Env = append(env, conformance.ReportEnv+"="+reportPath)
+		output, err := cmd.CombinedOutput()
+
+		status := "ok"
+		if err != nil {
+			var ee *exec.ExitError
+			if !errors.As(err, &ee) {
+				return err
+			}
+			status = "FAIL"
+			b.failed = true
+		}
+		fmt.Fprintf(out, "%s\t%s %s %s\n", status, b.name, pt.pkg, pt.name)
+		if conf.verbose || status != "ok" {
+			out.Write(output)
+		}
+
+		if _, err = os.Stat(reportPath); err != nil {
+			continue
+		}
+		r, err := conformance.LoadReport(reportPath)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, r)
+	}
+
+	if len(reports) > 0 {
+		b.report = new(conformance.Report)
+		b.report.Merge(reports...)
+	}
+	return nil
+}
+
+// goModInfo returns the module path and the go version from the go.mod file in the "dir" directory.
+func goModInfo(dir string) (string, string, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", "", err
+	}
+	mod, goVersion := "", ""
+	s := bufio.NewScanner(bytes.NewReader(raw))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			mod = strings.Trim(fields[1], `"`)
+		case "go":
+			goVersion = fields[1]
+		}
+	}
+	if mod == "" {
+		return "", "", fmt.Errorf("no module directive in %s", filepath.Join(dir, "go.mod"))
+	}
+	return mod, goVersion, s.Err()
+}
+
+// writeWorkspace creates a go.work file in the "dir" directory, which uses the backend and the suite modules.
+// Its go version is the highest one of the two modules.
+func writeWorkspace(dir, backendDir, suiteDir string) (string, error) {
+	if _, _, err := goModInfo(backendDir); err != nil {
+		return "", err
+	}
+	goVersion := "1.25.0"
+	for _, d := range []string{backendDir, suiteDir} {
+		if _, v, _ := goModInfo(d); v != "" && version.Compare("go"+v, "go"+goVersion) > 0 {
+			goVersion = v
+		}
+	}
+
+	work := filepath.Join(dir, "go.work")
+	contents := fmt.Sprintf("go %s\n\nuse (\n\t%q\n\t%q\n)\n", goVersion, backendDir, suiteDir)
+	return work, os.WriteFile(work, []byte(contents), 0o644)
+}
+
+type pkgTest struct {
+	pkg  string
+	name string
+}
+
+// listTests returns the top level tests of all the packages of the module in the "dir" directory.
+func listTests(ctx context.Context, dir string, env []string) ([]pkgTest, error) {
+	cmd := exec.CommandContext(ctx, "go", "test", "-tags", "conformance", "-list", ".", "./...")
+	cmd.Dir = dir
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tests: %w\n%s", err, output)
+	}
+	return parseTestList(output), nil
+}
+
+// parseTestList parses the output of "go test -list", where the names of the tests of each package
+// are followed by an "ok" line containing the package path.
+func parseTestList(output []byte) []pkgTest {
+	tests := make([]pkgTest, 0)
+	names := make([]string, 0)
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		line := s.Text()
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "ok" && len(fields) > 1:
+			for _, name := range names {
+				tests = append(tests, pkgTest{pkg: fields[1], name: name})
+			}
+			names = names[:0]
+		case fields[0] == "?":
+			names = names[:0]
+		case len(fields) == 1 && strings.HasPrefix(line, "Test"):
+			names = append(names, line)
+		}
+	}
+	return tests
+}
+
+// uniqueNames suffixes the names of the backends which have the same name as other ones with their position
+// in the arguments, so the columns of the matrix and the report directories can be told apart.
+func uniqueNames(backends []*backend) {
+	counts := make(map[string]int)
+	for _, b := range backends {
+		counts[b.name]++
+	}
+	for i, b := range backends {
+		if counts[b.name] > 1 {
+			b.name = fmt.Sprintf("%s#%d", b.name, i+1)
+		}
+	}
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func sanitize(s string) string {
+	return strings.Trim(unsafeChars.ReplaceAllString(s, "_"), "_")
+}
+
+// writeMatrix writes a table with the status of every requirement in the catalog for each of the backends,
+// followed by their conformance levels.
+func writeMatrix(w io.Writer, backends []*backend) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	header := []string{"REQUIREMENT", "LEVEL"}
+	statuses := make([]map[string]conformance.Status, 0, len(backends))
+	for _, b := range backends {
+		header = append(header, b.name)
+		st := make(map[string]conformance.Status)
+		if b.report != nil {
+			st = b.report.RequirementStatus()
+		}
+		statuses = append(statuses, st)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, req := range conformance.Requirements() {
+		row := []string{req.ID, req.Level.String()}
+		for _, st := range statuses {
+			s, ok := st[req.ID]
+			if !ok {
+				s = "-"
+			}
+			row = append(row, string(s))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	levels := []string{"CONFORMANCE", ""}
+	for _, b := range backends {
+		level := "-"
+		if b.report != nil {
+			level = string(b.report.Level)
+		}
+		levels = append(levels, level)
+	}
+	fmt.Fprintln(tw, strings.Join(levels, "\t"))
+	return tw.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseTestList(t *testing.T) {
+	output := `Test_Conformance
+Test_ConformanceWithFactory
+Example_usage
+ok  	github.com/go-ap/storage-fs	0.012s
+?   	github.com/go-ap/storage-fs/internal/cache	[no test files]
+TestLoad
+ok  	github.com/go-ap/storage-fs/internal/index	0.004s
+`
+	want := []pkgTest{
+		{pkg: "github.com/go-ap/storage-fs", name: "Test_Conformance"},
+		{pkg: "github.com/go-ap/storage-fs", name: "Test_ConformanceWithFactory"},
+		{pkg: "github.com/go-ap/storage-fs/internal/index", name: "TestLoad"},
+	}
+	got := parseTestList([]byte(output))
+	if !cmp.Equal(want, got, cmp.AllowUnexported(pkgTest{})) {
+		t.Errorf("parseTestList() = %s", cmp.Diff(want, got, cmp.AllowUnexported(pkgTest{})))
+	}
+}
+
+func Test_writeWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	backendDir := filepath.Join(dir, "storage-fs")
+	suiteDir := filepath.Join(dir, "storage-conformance-suite")
+	for path, mod := range map[string]string{
+		backendDir: "module github.com/go-ap/storage-fs\n\ngo 1.26.1\n",
+		suiteDir:   "module " + suiteModule + "\n\ngo 1.25.0\n",
+	} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatalf("unable to create module dir: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(path, "go.mod"), []byte(mod), 0o644); err != nil {
+			t.Fatalf("unable to write go.mod: %s", err)
+		}
+	}
+
+	work, err := writeWorkspace(dir, backendDir, suiteDir)
+	if err != nil {
+		t.Fatalf("unable to write workspace: %s", err)
+	}
+	raw, err := os.ReadFile(work)
+	if err != nil {
+		t.Fatalf("unable to read workspace: %s", err)
+	}
+	for _, want := range []string{"go 1.26.1", backendDir, suiteDir} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("go.work does not contain %q:\n%s", want, raw)
+		}
+	}
+}
+
+func Test_sanitize(t *testing.T) {
+	if got := sanitize("github.com/go-ap/storage-fs.Test_Conformance"); got != "github.com_go-ap_storage-fs.Test_Conformance" {
+		t.Errorf("sanitize() = %s", got)
+	}
+}
+
+func Test_uniqueNames(t *testing.T) {
+	backends := []*backend{
+		{name: "storage-fs", dir: "/src/a/storage-fs"},
+		{name: "storage-sqlite", dir: "/src/storage-sqlite"},
+		{name: "storage-fs", dir: "/src/b/storage-fs"},
+		{name: "storage-fs", dir: "/src/b/storage-fs"},
+	}
+	uniqueNames(backends)
+
+	got := make([]string, 0, len(backends))
+	for _, b := range backends {
+		got = append(got, b.name)
+	}
+	want := []string{"storage-fs#1", "storage-sqlite", "storage-fs#3", "storage-fs#4"}
+	if !cmp.Equal(want, got) {
+		t.Errorf("invalid backend names %s", cmp.Diff(want, got))
+	}
+}
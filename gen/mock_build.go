@@ -3,7 +3,7 @@ package gen
 import (
 	"bytes"
 	"encoding/base64"
-	"math/rand"
+	"maps"
 	"mime"
 	"net/http"
 	"path/filepath"
@@ -18,14 +18,22 @@ import (
 	vocab "github.com/go-ap/activitypub"
 	"github.com/go-ap/filters"
 	"github.com/go-ap/storage-conformance-suite/gen/names"
+	"golang.org/x/text/language"
 )
 
 var (
-	BaseTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	BaseTime = baseTime
 
 	DefaultHost vocab.IRI = "https://example.com"
 	RootID                = DefaultHost.AddPath("~root")
 
+	// RemoteHosts are the hosts of the other instances, whose actors and activities get cached locally.
+	RemoteHosts = []vocab.IRI{
+		"https://social.example.org",
+		"https://fediverse.example.net",
+		"https://mastodon.example:8443",
+	}
+
 	publicAudience = vocab.ItemCollection{vocab.PublicNS}
 
 	Root = &vocab.Actor{
@@ -79,6 +87,9 @@ var (
 	genCache = sync.Map{}
 
 	typeCountMap = make(map[string]int)
+	typeCountM   sync.Mutex
+
+	timeM sync.Mutex
 )
 
 func addToGenCache(it vocab.Item) {
@@ -94,6 +105,9 @@ func getFromCache(ff ...filters.Check) vocab.ItemCollection {
 		}
 		return true
 	})
+	// NOTE(marius): the order of the sync.Map iteration is random, so we sort the items
+	// to keep the generated data reproducible for the same seed.
+	SortItemCollectionByID(result)
 	return result
 }
 
@@ -114,41 +128,63 @@ func typeMatchMimeType(typ vocab.ActivityVocabularyType, mt string) bool {
 	}
 }
 
-func getContentByType(typ vocab.ActivityVocabularyType) []byte {
+// contentByMimeType returns the files from ContentMap whose mime type matches, in a stable order.
+func contentByMimeType(match func(mt string) bool) [][]byte {
+	mimeTypes := make([]string, 0, len(ContentMap))
+	for mimeType := range ContentMap {
+		if match(mimeType) {
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+	}
+	slices.Sort(mimeTypes)
+
 	validArray := make([][]byte, 0)
-	for mimeType, files := range ContentMap {
-		if !typeMatchMimeType(typ, mimeType) {
-			continue
+	for _, mimeType := range mimeTypes {
+		files := ContentMap[mimeType]
+		langs := make([]vocab.LangRef, 0, len(files))
+		for lang := range files {
+			langs = append(langs, lang)
 		}
-		for _, file := range files {
-			validArray = append(validArray, file)
+		slices.SortFunc(langs, func(a, b vocab.LangRef) int {
+			return strings.Compare(language.Tag(a).String(), language.Tag(b).String())
+		})
+		for _, lang := range langs {
+			validArray = append(validArray, files[lang])
 		}
 	}
+	return validArray
+}
+
+func getContentByType(typ vocab.ActivityVocabularyType) []byte {
+	validArray := contentByMimeType(func(mt string) bool {
+		return typeMatchMimeType(typ, mt)
+	})
 	if len(validArray) == 0 {
 		return nil
 	}
-	return validArray[rand.Intn(len(validArray))]
+	return validArray[rnd.IntN(len(validArray))]
 }
 
 func getRandomContent() []byte {
-	validArray := make([][]byte, 0)
-	for _, files := range ContentMap {
-		for _, file := range files {
-			validArray = append(validArray, file)
-		}
-	}
+	validArray := contentByMimeType(func(_ string) bool {
+		return true
+	})
 	if len(validArray) == 0 {
 		return nil
 	}
-	return validArray[rand.Int()%len(validArray)]
+	return validArray[rnd.IntN(len(validArray))]
 }
 
 // getRandomTime we use a random time,
 // because time.Now() contains monotonic information which we don't care about
 func getRandomTime() time.Time {
-	hour := time.Duration(rand.Int31n(24)) * time.Hour
-	minute := time.Duration(rand.Int31n(59)) * time.Minute
-	second := time.Duration(rand.Int31n(59)) * time.Second
+	hour := time.Duration(rnd.IntN(24)) * time.Hour
+	minute := time.Duration(rnd.IntN(59)) * time.Minute
+	second := time.Duration(rnd.IntN(59)) * time.Second
+
+	timeM.Lock()
+	defer timeM.Unlock()
+
 	BaseTime = BaseTime.Add(hour + minute + second)
 	return BaseTime
 }
@@ -163,6 +199,15 @@ func typeAsString(typ vocab.Typer) string {
 	return "unknown"
 }
 
+// nextTypeCount increments and returns the number of items generated for the "typ" type.
+func nextTypeCount(typ string) int {
+	typeCountM.Lock()
+	defer typeCountM.Unlock()
+
+	typeCountMap[typ]++
+	return typeCountMap[typ]
+}
+
 func setObjectID(ob *vocab.Object) error {
 	isCollection := vocab.IsCollection(ob)
 	pieces := make([]string, 0)
@@ -176,10 +221,7 @@ func setObjectID(ob *vocab.Object) error {
 		pieces = append(pieces, typ)
 	} else {
 		typ := strings.ToLower(typeAsString(ob.Type))
-		cnt, _ := typeCountMap[typ]
-		cnt++
-		typeCountMap[typ] = cnt
-		pieces = append(pieces, typ, strconv.Itoa(cnt))
+		pieces = append(pieces, typ, strconv.Itoa(nextTypeCount(typ)))
 	}
 	ob.ID = base.AddPath(filepath.Join(pieces...))
 	return nil
@@ -190,10 +232,7 @@ func setLinkID(ob *vocab.Link) error {
 	pieces := make([]string, 0)
 	pieces = append(pieces, "/")
 	typ := strings.ToLower(typeAsString(ob.Type))
-	cnt, _ := typeCountMap[typ]
-	cnt++
-	typeCountMap[typ] = cnt
-	pieces = append(pieces, typ, strconv.Itoa(cnt))
+	pieces = append(pieces, typ, strconv.Itoa(nextTypeCount(typ)))
 	ob.ID = base.AddPath(filepath.Join(pieces...))
 	return nil
 }
@@ -232,7 +271,7 @@ func randomActivity(actFn func(vocab.LinkOrIRI, vocab.LinkOrIRI) vocab.Item) fun
 		if objs := getFromCache(matchFilters); len(objs) == 0 {
 			obj = RandomObject(attrTo)
 		} else {
-			obj = objs[rand.Intn(len(objs))]
+			obj = objs[rnd.IntN(len(objs))]
 		}
 		return actFn(obj, attrTo)
 	}
@@ -240,7 +279,7 @@ func randomActivity(actFn func(vocab.LinkOrIRI, vocab.LinkOrIRI) vocab.Item) fun
 
 func RandomItem(attrTo vocab.LinkOrIRI) vocab.Item {
 	genFns := append(itemGenFns, randomActivity(CreateActivity), randomActivity(RandomNonNonContentActivity))
-	fn := genFns[rand.Intn(len(genFns))]
+	fn := genFns[rnd.IntN(len(genFns))]
 	return fn(attrTo)
 }
 
@@ -328,6 +367,61 @@ func RandomObject(attrTo vocab.LinkOrIRI) vocab.Item {
 	return ob
 }
 
+// naturalLanguageSample is a value in a specific language, used for building multilingual items.
+type naturalLanguageSample struct {
+	lang  vocab.LangRef
+	value string
+}
+
+var (
+	// multilingualNames are values which get mangled easily: right to left and CJK scripts, and combining
+	// characters, which must not be normalized.
+	multilingualNames = []naturalLanguageSample{
+		{lang: vocab.LangRef(language.Arabic), value: "مرحبا بالعالم"},
+		{lang: vocab.LangRef(language.Hebrew), value: "שלום עולם"},
+		{lang: vocab.LangRef(language.Korean), value: "안녕하세요 세계"},
+		{lang: vocab.LangRef(language.Japanese), value: "こんにちは、世界"},
+		{lang: vocab.LangRef(language.TraditionalChinese), value: "你好，世界"},
+		{lang: vocab.LangRef(language.French), value: "Ame\u0301lie et Zoe\u0308"},
+		{lang: vocab.NilLangRef, value: "¯\\_(ツ)_/¯"},
+	}
+	multilingualSummaries = []naturalLanguageSample{
+		{lang: vocab.LangRef(language.Danish), value: "Blåbærgrød med fløde"},
+		{lang: vocab.LangRef(language.Arabic), value: "ملخص قصير"},
+		{lang: vocab.LangRef(language.Korean), value: "짧은 요약"},
+		{lang: vocab.NilLangRef, value: "\u200fmixed עברית and English\u200e"},
+	}
+)
+
+// randomNaturalLanguageValues returns the English "value", and a random subset of the samples.
+func randomNaturalLanguageValues(value string, samples []naturalLanguageSample) vocab.NaturalLanguageValues {
+	nlv := make(vocab.NaturalLanguageValues)
+	_ = nlv.Append(vocab.DefaultLang, vocab.Content(value))
+	for _, s := range samples {
+		if rnd.IntN(2) == 0 {
+			_ = nlv.Append(s.lang, vocab.Content(s.value))
+		}
+	}
+	return nlv
+}
+
+// RandomMultilingualObject generates a Note whose name, summary and content have values in multiple languages.
+// The content is one of the HTML files, in all the languages they are available in.
+func RandomMultilingualObject(attrTo vocab.LinkOrIRI) vocab.Item {
+	ob := new(vocab.Object)
+	ob.Type = vocab.NoteType
+	ob.MediaType = "text/html"
+	ob.AttributedTo = attrTo.GetLink()
+	ob.Published = getRandomTime()
+	ob.Name = randomNaturalLanguageValues(getRandomName().String(), multilingualNames)
+	ob.Summary = randomNaturalLanguageValues(getRandomWord(), multilingualSummaries)
+	ob.Content = maps.Clone(ContentMap["text/html"])
+	SetItemID(ob)
+	ob.Audience = publicAudience
+
+	return ob
+}
+
 var svgDocumentStart = []byte{'<', 's', 'v', 'g'}
 
 func getObjectTypes(data []byte) (vocab.ActivityVocabularyType, vocab.MimeType) {
@@ -380,39 +474,39 @@ var reasons = []string{
 }
 
 func getRandomReason() string {
-	return reasons[rand.Intn(len(reasons))]
+	return reasons[rnd.IntN(len(reasons))]
 }
 
 func getActivityTypeByObject(ob vocab.Item) vocab.ActivityVocabularyType {
 	if vocab.IsNil(ob) {
-		return typesWorkOnObjects[rand.Int()%len(typesWorkOnObjects)]
+		return typesWorkOnObjects[rnd.Int()%len(typesWorkOnObjects)]
 	}
 
 	typ := ob.GetType()
 	switch {
 	case vocab.ActivityTypes.Match(typ):
-		return typesWorkOnActivities[rand.Intn(len(typesWorkOnActivities))]
+		return typesWorkOnActivities[rnd.IntN(len(typesWorkOnActivities))]
 	case vocab.ActorTypes.Match(typ):
-		return typesWorkOnActors[rand.Intn(len(typesWorkOnActors))]
+		return typesWorkOnActors[rnd.IntN(len(typesWorkOnActors))]
 	}
 
-	return typesWorkOnActors[rand.Intn(len(typesWorkOnObjects))]
+	return typesWorkOnActors[rnd.IntN(len(typesWorkOnObjects))]
 }
 
 func getNonDestructiveActivityTypeByObject(ob vocab.Item) vocab.ActivityVocabularyType {
 	if vocab.IsNil(ob) {
-		return typesWorkOnObjects[rand.Int()%len(typesWorkOnObjects)]
+		return typesWorkOnObjects[rnd.Int()%len(typesWorkOnObjects)]
 	}
 
 	typ := ob.GetType()
 	switch {
 	case vocab.ActivityTypes.Match(typ):
-		return typesWorkNonDestructivelyOnActivities[rand.Intn(len(typesWorkNonDestructivelyOnActivities))]
+		return typesWorkNonDestructivelyOnActivities[rnd.IntN(len(typesWorkNonDestructivelyOnActivities))]
 	case vocab.ActorTypes.Match(typ):
-		return typesWorkNonDestructivelyOnActors[rand.Intn(len(typesWorkNonDestructivelyOnActors))]
+		return typesWorkNonDestructivelyOnActors[rnd.IntN(len(typesWorkNonDestructivelyOnActors))]
 	}
 
-	return typesWorkNonDestructivelyOnActors[rand.Intn(len(typesWorkNonDestructivelyOnObjects))]
+	return typesWorkNonDestructivelyOnActors[rnd.IntN(len(typesWorkNonDestructivelyOnObjects))]
 }
 
 func RandomNonNonContentActivity(ob vocab.LinkOrIRI, attrTo vocab.LinkOrIRI) vocab.Item {
@@ -449,8 +543,8 @@ func RandomQuestion(attrTo vocab.LinkOrIRI) vocab.Item {
 	act.To = vocab.ItemCollection{RootID, vocab.PublicNS}
 	act.Published = getRandomTime()
 
-	oneOf := rand.Intn(2) == 1
-	count := rand.Intn(10)
+	oneOf := rnd.IntN(2) == 1
+	count := rnd.IntN(10)
 	opts := RandomItemCollection(count, attrTo)
 	if oneOf {
 		act.OneOf = opts
@@ -463,12 +557,12 @@ func RandomQuestion(attrTo vocab.LinkOrIRI) vocab.Item {
 }
 
 func getRandomActorType() vocab.ActivityVocabularyType {
-	return vocab.ActorTypes[rand.Intn(len(vocab.ActorTypes))]
+	return vocab.ActorTypes[rnd.IntN(len(vocab.ActorTypes))]
 }
 
 func RandomActor(attrTo vocab.LinkOrIRI) vocab.Item {
 	act := new(vocab.Actor)
-	act.Name = vocab.DefaultNaturalLanguage(names.GetRandom())
+	act.Name = vocab.DefaultNaturalLanguage(names.Random(rnd))
 	act.PreferredUsername = act.Name
 	act.Type = getRandomActorType()
 	act.AttributedTo = attrTo.GetLink()
@@ -490,6 +584,11 @@ func RandomActor(attrTo vocab.LinkOrIRI) vocab.Item {
 	return act
 }
 
+// RandomRemoteActor returns an actor of the "host" remote instance, which is attributed to the instance itself.
+func RandomRemoteActor(host vocab.IRI) vocab.Item {
+	return RandomActor(host)
+}
+
 func getRandomContentByMimeType(mimeType vocab.MimeType) []byte {
 	if validArray, ok := ContentMap[string(mimeType)]; ok {
 		return validArray.First()
@@ -519,7 +618,7 @@ var (
 )
 
 func getRandomWord() string {
-	return words[rand.Intn(len(words))]
+	return words[rnd.IntN(len(words))]
 }
 
 func RandomTag(attrTo vocab.LinkOrIRI) vocab.Item {
@@ -548,15 +647,15 @@ func RandomImage(mime vocab.MimeType, parent vocab.Item) vocab.Item {
 }
 
 func getRandomLinkType() vocab.ActivityVocabularyType {
-	return vocab.LinkTypes[rand.Intn(len(vocab.LinkTypes))]
+	return vocab.LinkTypes[rnd.IntN(len(vocab.LinkTypes))]
 }
 
 func getRandomName() vocab.NaturalLanguageValues {
-	return vocab.DefaultNaturalLanguage(names.GetRandom())
+	return vocab.DefaultNaturalLanguage(names.Random(rnd))
 }
 
 func getRandomHref() vocab.IRI {
-	return DefaultHost.AddPath(filepath.Join(strings.Split(names.GetRandom(), "_")...))
+	return DefaultHost.AddPath(filepath.Join(strings.Split(names.Random(rnd), "_")...))
 }
 
 func RandomLink(_ vocab.LinkOrIRI) vocab.Item {
@@ -596,7 +695,7 @@ var nonActivityGenFns = []generatorFn{
 }
 
 func RandomNonActivity(attrTo vocab.LinkOrIRI) vocab.Item {
-	fn := nonActivityGenFns[rand.Intn(len(nonActivityGenFns))]
+	fn := nonActivityGenFns[rnd.IntN(len(nonActivityGenFns))]
 	return fn(attrTo)
 }
 
@@ -624,7 +723,7 @@ func PlausibleStorage(attrTo vocab.Item, cnt int) []vocab.LinkOrIRI {
 	}
 
 	for range obCnt {
-		act := actors[rand.Intn(len(actors))]
+		act := actors[rnd.IntN(len(actors))]
 		ob := RandomNonActivity(act)
 		objects = append(objects, ob)
 		activities = append(activities, CreateActivity(ob, act))
@@ -633,8 +732,8 @@ func PlausibleStorage(attrTo vocab.Item, cnt int) []vocab.LinkOrIRI {
 	objects = append(objects, actors...)
 	remActCnt := cnt - len(objects)
 	for range remActCnt {
-		act := actors[rand.Intn(len(actors))]
-		ob := objects[rand.Intn(len(objects))]
+		act := actors[rnd.IntN(len(actors))]
+		ob := objects[rnd.IntN(len(objects))]
 		activities = append(activities, RandomNonNonContentActivity(ob, act))
 	}
 
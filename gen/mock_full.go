@@ -0,0 +1,217 @@
+package gen
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+)
+
+// refIRI returns a new IRI for an item referenced by the generated items, which doesn't need to exist.
+func refIRI(kind string) vocab.IRI {
+	return DefaultHost.AddPath(kind, strconv.Itoa(nextTypeCount(kind)))
+}
+
+// pageIRI returns the IRI of the n-th page of the collection.
+func pageIRI(col vocab.IRI, n int) vocab.IRI {
+	return vocab.IRI(fmt.Sprintf("%s?page=%d", col, n))
+}
+
+func getRandomSentence(cnt int) string {
+	w := make([]string, 0, cnt)
+	for range cnt {
+		w = append(w, getRandomWord())
+	}
+	return strings.Join(w, " ")
+}
+
+func getRandomPublicKeyPem() string {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(rnd.IntN(256))
+	}
+	pub := ed25519.NewKeyFromSeed(seed).Public()
+	raw, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: raw}))
+}
+
+// FullItemByType builds an item of the "typ" type, using the concrete type returned by [vocab.GetItemByType],
+// with all the properties of that type set to random values.
+// The items it references, like the objects of activities, the tags, or the items of collections, are IRIs.
+func FullItemByType(typ vocab.ActivityVocabularyType, attrTo vocab.LinkOrIRI) (vocab.Item, error) {
+	it, err := vocab.GetItemByType(typ)
+	if err != nil {
+		return nil, err
+	}
+	if vocab.IsNil(it) || vocab.IsIRI(it) || vocab.IsItemCollection(it) {
+		return nil, fmt.Errorf("type %s doesn't correspond to an object or a link", typ)
+	}
+	if vocab.IsLink(it) {
+		err = vocab.OnLink(it, func(l *vocab.Link) error {
+			l.Type = typ
+			l.MediaType = "text/html"
+			l.Height = uint(1 + rnd.IntN(1080))
+			l.Width = uint(1 + rnd.IntN(1920))
+			l.Name = getRandomName()
+			l.HrefLang = vocab.DefaultLang
+			l.Href = getRandomHref()
+			l.Rel = "canonical"
+			l.Preview = refIRI("previews")
+			return nil
+		})
+		SetItemID(it)
+		return it, err
+	}
+
+	err = vocab.OnObject(it, func(ob *vocab.Object) error {
+		ob.Type = typ
+		ob.AttributedTo = attrTo.GetLink()
+		ob.Name = getRandomName()
+		ob.Summary = vocab.DefaultNaturalLanguage(getRandomSentence(5))
+		ob.Content = vocab.DefaultNaturalLanguage(fmt.Sprintf("<p>%s</p>", getRandomSentence(20)))
+		ob.MediaType = "text/html"
+		ob.Source = vocab.Source{
+			Content:   vocab.DefaultNaturalLanguage(getRandomSentence(20)),
+			MediaType: "text/markdown",
+		}
+		ob.Published = getRandomTime()
+		ob.Updated = ob.Published.Add(time.Hour)
+		ob.Duration = time.Duration(1+rnd.IntN(24)) * time.Hour
+		ob.StartTime = ob.Published
+		ob.EndTime = ob.Published.Add(ob.Duration)
+		ob.Attachment = refIRI("attachments")
+		ob.Context = refIRI("contexts")
+		ob.Generator = refIRI("generators")
+		ob.Icon = refIRI("icons")
+		ob.Image = refIRI("images")
+		ob.InReplyTo = refIRI("objects")
+		ob.Location = refIRI("places")
+		ob.Preview = refIRI("previews")
+		ob.URL = refIRI("urls")
+		ob.Tag = vocab.ItemCollection{refIRI("tags")}
+		ob.Audience = publicAudience
+		ob.To = vocab.ItemCollection{RootID, vocab.PublicNS}
+		ob.CC = vocab.ItemCollection{vocab.Followers.IRI(attrTo.GetLink())}
+		ob.Bto = vocab.ItemCollection{refIRI("actors")}
+		ob.BCC = vocab.ItemCollection{refIRI("actors")}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	SetItemID(it)
+	err = vocab.OnObject(it, func(ob *vocab.Object) error {
+		ob.Replies = vocab.Replies.IRI(ob)
+		ob.Likes = vocab.Likes.IRI(ob)
+		ob.Shares = vocab.Shares.IRI(ob)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch ob := it.(type) {
+	case *vocab.Actor:
+		ob.PreferredUsername = vocab.DefaultNaturalLanguage(strings.ToLower(ob.Name.String()))
+		ob.Inbox = vocab.Inbox.IRI(ob)
+		ob.Outbox = vocab.Outbox.IRI(ob)
+		ob.Following = vocab.Following.IRI(ob)
+		ob.Followers = vocab.Followers.IRI(ob)
+		ob.Liked = vocab.Liked.IRI(ob)
+		ob.Streams = vocab.ItemCollection{ob.ID.AddPath("streams")}
+		ob.Endpoints = &vocab.Endpoints{
+			UploadMedia:                ob.ID.AddPath("upload"),
+			OauthAuthorizationEndpoint: DefaultHost.AddPath("oauth", "authorize"),
+			OauthTokenEndpoint:         DefaultHost.AddPath("oauth", "token"),
+			ProvideClientKey:           DefaultHost.AddPath("oauth", "client-key"),
+			SignClientKey:              DefaultHost.AddPath("oauth", "sign-key"),
+			SharedInbox:                DefaultHost.AddPath("inbox"),
+		}
+		ob.PublicKey = vocab.PublicKey{
+			ID:           vocab.IRI(fmt.Sprintf("%s#main-key", ob.ID)),
+			Owner:        ob.ID,
+			PublicKeyPem: getRandomPublicKeyPem(),
+		}
+	case *vocab.Activity:
+		ob.Actor = attrTo.GetLink()
+		ob.Object = refIRI("objects")
+		ob.Target = refIRI("objects")
+		ob.Result = refIRI("objects")
+		ob.Origin = refIRI("objects")
+		ob.Instrument = refIRI("objects")
+	case *vocab.IntransitiveActivity:
+		ob.Actor = attrTo.GetLink()
+		ob.Target = refIRI("objects")
+		ob.Result = refIRI("objects")
+		ob.Origin = refIRI("objects")
+		ob.Instrument = refIRI("objects")
+	case *vocab.Question:
+		ob.Actor = attrTo.GetLink()
+		ob.Target = refIRI("objects")
+		ob.Result = refIRI("objects")
+		ob.Origin = refIRI("objects")
+		ob.Instrument = refIRI("objects")
+		// NOTE(marius): a Question has either exclusive or inclusive options, never both
+		ob.OneOf = vocab.ItemCollection{
+			&vocab.Object{Type: vocab.NoteType, Name: getRandomName()},
+			&vocab.Object{Type: vocab.NoteType, Name: getRandomName()},
+		}
+		ob.Closed = true
+	case *vocab.Place:
+		ob.Accuracy = float64(rnd.IntN(100))
+		ob.Altitude = float64(rnd.IntN(1000))
+		ob.Latitude = float64(rnd.IntN(180000)-90000) / 1000
+		ob.Longitude = float64(rnd.IntN(360000)-180000) / 1000
+		ob.Radius = int64(1 + rnd.IntN(100))
+		ob.Units = "km"
+	case *vocab.Profile:
+		ob.Describes = attrTo.GetLink()
+	case *vocab.Relationship:
+		ob.Subject = attrTo.GetLink()
+		ob.Object = refIRI("actors")
+		ob.Relationship = vocab.IRI("http://purl.org/vocab/relationship/acquaintanceOf")
+	case *vocab.Tombstone:
+		ob.FormerType = vocab.NoteType
+		ob.Deleted = ob.Updated
+	case *vocab.Collection:
+		ob.Items = vocab.ItemCollection{refIRI("objects"), refIRI("objects")}
+		ob.TotalItems = uint(len(ob.Items))
+		ob.First = pageIRI(ob.ID, 1)
+		ob.Last = pageIRI(ob.ID, 1)
+		ob.Current = pageIRI(ob.ID, 1)
+	case *vocab.OrderedCollection:
+		ob.OrderedItems = vocab.ItemCollection{refIRI("objects"), refIRI("objects")}
+		ob.TotalItems = uint(len(ob.OrderedItems))
+		ob.First = pageIRI(ob.ID, 1)
+		ob.Last = pageIRI(ob.ID, 1)
+		ob.Current = pageIRI(ob.ID, 1)
+	case *vocab.CollectionPage:
+		ob.Items = vocab.ItemCollection{refIRI("objects"), refIRI("objects")}
+		ob.TotalItems = 10
+		ob.PartOf = refIRI("collections")
+		ob.First = pageIRI(ob.PartOf.GetLink(), 1)
+		ob.Last = pageIRI(ob.PartOf.GetLink(), 5)
+		ob.Current = pageIRI(ob.PartOf.GetLink(), 2)
+		ob.Prev = ob.First
+		ob.Next = pageIRI(ob.PartOf.GetLink(), 3)
+	case *vocab.OrderedCollectionPage:
+		ob.OrderedItems = vocab.ItemCollection{refIRI("objects"), refIRI("objects")}
+		ob.TotalItems = 10
+		ob.StartIndex = 2
+		ob.PartOf = refIRI("collections")
+		ob.First = pageIRI(ob.PartOf.GetLink(), 1)
+		ob.Last = pageIRI(ob.PartOf.GetLink(), 5)
+		ob.Current = pageIRI(ob.PartOf.GetLink(), 2)
+		ob.Prev = ob.First
+		ob.Next = pageIRI(ob.PartOf.GetLink(), 3)
+	}
+	return it, nil
+}
@@ -4,7 +4,7 @@ package names
 
 import (
 	"fmt"
-	"math/rand"
+	"math/rand/v2"
 )
 
 var (
@@ -849,5 +849,11 @@ var (
 // GetRandom generates a random name from the list of adjectives and surnames in this package
 // formatted as "adjective_surname". For example 'focused_turing'.
 func GetRandom() string {
-	return fmt.Sprintf("%s_%s", left[rand.Intn(len(left))], right[rand.Intn(len(right))])
+	return fmt.Sprintf("%s_%s", left[rand.IntN(len(left))], right[rand.IntN(len(right))])
+}
+
+// Random generates a random name like GetRandom, but using "r" as the source of randomness,
+// so the names can be reproduced by seeding it with the same value.
+func Random(r *rand.Rand) string {
+	return fmt.Sprintf("%s_%s", left[r.IntN(len(left))], right[r.IntN(len(right))])
 }
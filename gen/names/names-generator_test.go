@@ -1,6 +1,7 @@
 package names
 
 import (
+	"math/rand/v2"
 	"slices"
 	"strings"
 	"testing"
@@ -23,3 +24,13 @@ func TestGetRandom(t *testing.T) {
 		}
 	}
 }
+
+func TestRandom(t *testing.T) {
+	r1 := rand.New(rand.NewPCG(42, 42))
+	r2 := rand.New(rand.NewPCG(42, 42))
+	for range 100 {
+		if n1, n2 := Random(r1), Random(r2); n1 != n2 {
+			t.Fatalf("Random() with the same seed returned different names %s != %s", n1, n2)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gen
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// baseTime is the initial value of BaseTime, which it gets reset to by Seed.
+var baseTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// lockedSource makes a random source safe for concurrent use.
+type lockedSource struct {
+	m   sync.Mutex
+	src rand.Source
+}
+
+func (l *lockedSource) Uint64() uint64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.src.Uint64()
+}
+
+func (l *lockedSource) reset(src rand.Source) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.src = src
+}
+
+var (
+	source = &lockedSource{src: rand.NewPCG(0, 0)}
+	// rnd is the source of randomness for all the generated data.
+	rnd = rand.New(source)
+
+	seed  uint64
+	seedM sync.Mutex
+)
+
+func init() {
+	Seed(rand.Uint64())
+}
+
+// Seed resets the state of the generator: the random source gets seeded with "s", and BaseTime,
+// the counters used for building item IDs and the cache of generated items get reset.
+// After it, the same sequence of calls generates the same items, with the same IDs and timestamps.
+func Seed(s uint64) {
+	seedM.Lock()
+	defer seedM.Unlock()
+
+	seed = s
+	source.reset(rand.NewPCG(s, s))
+
+	timeM.Lock()
+	BaseTime = baseTime
+	timeM.Unlock()
+
+	typeCountM.Lock()
+	clear(typeCountMap)
+	typeCountM.Unlock()
+
+	genCache.Clear()
+}
+
+// CurrentSeed returns the seed last passed to Seed.
+func CurrentSeed() uint64 {
+	seedM.Lock()
+	defer seedM.Unlock()
+
+	return seed
+}
@@ -0,0 +1,44 @@
+package gen
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSeed(t *testing.T) {
+	Seed(42)
+	first := RandomItemCollection(32, Root)
+	firstActor := RandomActor(Root)
+
+	Seed(42)
+	second := RandomItemCollection(32, Root)
+	secondActor := RandomActor(Root)
+
+	if CurrentSeed() != 42 {
+		t.Errorf("invalid current seed %d, expected %d", CurrentSeed(), 42)
+	}
+	if !cmp.Equal(first, second) {
+		t.Errorf("items generated with the same seed are different: %s", cmp.Diff(first, second))
+	}
+	if !cmp.Equal(firstActor, secondActor) {
+		t.Errorf("actors generated with the same seed are different: %s", cmp.Diff(firstActor, secondActor))
+	}
+
+	Seed(43)
+	if third := RandomItemCollection(32, Root); cmp.Equal(first, third) {
+		t.Errorf("items generated with different seeds are equal")
+	}
+}
+
+func TestSeed_resetsBaseTime(t *testing.T) {
+	Seed(1)
+	_ = RandomObject(Root)
+	if !BaseTime.After(baseTime) {
+		t.Errorf("BaseTime was not advanced by generating an object")
+	}
+	Seed(1)
+	if !BaseTime.Equal(baseTime) {
+		t.Errorf("BaseTime was not reset to %s, got %s", baseTime, BaseTime)
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
-	weak "math/rand"
+	"sync"
 	"testing"
 
 	vocab "github.com/go-ap/activitypub"
@@ -25,49 +25,75 @@ type KeyStorage interface {
 	SaveKey(iri vocab.IRI, key crypto.PrivateKey) (*vocab.PublicKey, error)
 }
 
-var (
-	privateKey, _ = rsa.GenerateKey(rand.Reader, 2048)
-
-	keys = genPrivateKeys()
-)
+var privateKey, _ = rsa.GenerateKey(rand.Reader, 2048)
 
-func initKeyStorage(storage KeyStorage) error {
-	pk, err := storage.SaveKey(gen.RootID, privateKey)
+// initKeyStorage saves the suite's private key for the "base" actor and stores a copy of it
+// with the resulting public key, so the package level [gen.Root] doesn't get modified.
+func initKeyStorage(storage KeyStorage, base *vocab.Actor) (*vocab.Actor, error) {
+	pk, err := storage.SaveKey(base.ID, privateKey)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	gen.Root.PublicKey = *pk
+	root := *base
+	root.PublicKey = *pk
 	apStorage, ok := storage.(ActivityPubStorage)
 	if ok {
-		_, _ = apStorage.Save(gen.Root)
+		_, _ = apStorage.Save(&root)
 	}
-	return nil
+	return &root, nil
 }
 
-func RunKeyTests(t *testing.T, storage ActivityPubStorage) {
+func mockKeyStorage(t *testing.T, newStorage StorageFactory) (ActivityPubStorage, KeyStorage) {
+	t.Helper()
+
+	storage := mockActivityPub(t, newStorage)
 	keyStorage, ok := storage.(KeyStorage)
-	if !ok {
-		t.Fatalf("storage %T is not compatible with Key store operations", storage)
+	requireCapability(t, storage, CapabilityKeys, ok)
+	return storage, keyStorage
+}
+
+func RunKeyTests(t *testing.T, storage ActivityPubStorage, opts ...Option) {
+	newRunner(sharedStorage(storage), opts...).start(t).runKeyTests(t)
+}
+
+func (r *runner) runKeyTests(t *testing.T) {
+	_, _ = mockKeyStorage(t, r.newStorage)
+
+	// NOTE(marius): in parallel mode, the root actor gets saved concurrently by the other test groups,
+	// so we save the key for a different one.
+	base := gen.Root
+	if r.conf.parallel {
+		base, _ = vocab.ToActor(gen.RandomActor(gen.RootID))
 	}
-	if err := initKeyStorage(keyStorage); err != nil {
-		t.Fatalf("unable to init Key pair test suite: %s", err)
+	keys := genPrivateKeys(r.conf.keyTypes)
+	actors := make([]vocab.Item, 0, len(keys))
+	for range keys {
+		actors = append(actors, gen.RandomActor(gen.RootID))
 	}
+	r.parallel(t)
 
-	t.Run("load Root key", func(t *testing.T) {
-		prv, err := keyStorage.LoadKey(gen.RootID)
+	r.require(t, "load Root key", reqKeyLoad, func(t *check) {
+		r.parallel(t.T)
+		storage, keyStorage := mockKeyStorage(t.T, r.newStorage)
+		root, err := initKeyStorage(keyStorage, base)
+		if err != nil {
+			t.Fatalf("unable to init Key pair test suite: %s", err)
+		}
+
+		prv, err := keyStorage.LoadKey(root.ID)
 		if err != nil {
 			t.Fatalf("unable to load private key %s", err)
 		}
 		if !cmp.Equal(privateKey, prv) {
 			t.Errorf("Loaded private key is different %s", cmp.Diff(privateKey, prv))
 		}
-		actor, err := storage.Load(gen.RootID)
+		actor, err := storage.Load(root.ID)
 		if err != nil {
 			t.Fatalf("unable to load actor item %s", err)
 		}
 		err = vocab.OnActor(actor, func(actor *vocab.Actor) error {
-			if !cmp.Equal(actor.PublicKey, gen.Root.PublicKey) {
-				t.Errorf("invalid root actor public key loaded from storage %s", cmp.Diff(gen.Root.PublicKey, actor.PublicKey))
+			if !cmp.Equal(actor.PublicKey, root.PublicKey) {
+				t.Errorf("invalid root actor public key loaded from storage %s", cmp.Diff(root.PublicKey, actor.PublicKey))
 			}
 
 			pub, ok := publicKey(prv)
@@ -90,13 +116,16 @@ func RunKeyTests(t *testing.T, storage ActivityPubStorage) {
 			return nil
 		})
 		if err != nil {
-			t.Fatalf("the item loaded for %s couldn't be converted to Actor: %s", gen.RootID, err)
+			t.Fatalf("the item loaded for %s couldn't be converted to Actor: %s", root.ID, err)
 		}
 	})
 
-	for _, key := range keys {
-		t.Run(fmt.Sprintf("save %T key", key), func(t *testing.T) {
-			it := gen.RandomActor(gen.RootID)
+	for i, key := range keys {
+		it := actors[i]
+		r.require(t, fmt.Sprintf("save %T key", key), reqKeyTypes, func(t *check) {
+			r.parallel(t.T)
+			storage, keyStorage := mockKeyStorage(t.T, r.newStorage)
+
 			actor, err := vocab.ToActor(it)
 			if err != nil {
 				t.Fatalf("unable to generate random actor: %s", err)
@@ -107,7 +136,7 @@ func RunKeyTests(t *testing.T, storage ActivityPubStorage) {
 			}
 			actor.PublicKey = *pub
 			_, _ = storage.Save(actor)
-			t.Run(fmt.Sprintf("load %T key", key), func(t *testing.T) {
+			r.require(t.T, fmt.Sprintf("load %T key", key), reqKeyTypes, func(t *check) {
 				actorIRI := actor.GetLink()
 				prv, err := keyStorage.LoadKey(actorIRI)
 				if err != nil {
@@ -148,44 +177,77 @@ func RunKeyTests(t *testing.T, storage ActivityPubStorage) {
 	}
 }
 
-func getPrivateKey() crypto.PrivateKey {
-	return keys[weak.Intn(len(keys))]
-}
+// KeyType is a type of private key the Key tests can exercise.
+type KeyType uint8
 
-func genPrivateKeys() []crypto.PrivateKey {
-	keys := make([]crypto.PrivateKey, 0, 7)
+const (
+	KeyECDSAP224 KeyType = 1 << iota
+	KeyECDSAP256
+	KeyECDSAP384
+	KeyECDSAP521
+	KeyED25519
+	KeyRSA2048
+	KeyRSA4096
 
-	e224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
-	if err == nil {
-		keys = append(keys, e224)
-	}
-	e256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err == nil {
-		keys = append(keys, e256)
-	}
-	e384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
-	if err == nil {
-		keys = append(keys, e384)
-	}
-	e521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
-	if err == nil {
-		keys = append(keys, e521)
-	}
-	_, ed, err := ed25519.GenerateKey(rand.Reader)
-	if err == nil {
-		keys = append(keys, ed)
-	}
-	r2048, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err == nil {
-		keys = append(keys, r2048)
+	KeyTypesAll = KeyECDSAP224 | KeyECDSAP256 | KeyECDSAP384 | KeyECDSAP521 | KeyED25519 | KeyRSA2048 | KeyRSA4096
+)
+
+var (
+	// generatedKeys caches the private keys by type, as the RSA ones are slow to generate.
+	generatedKeys  = make(map[KeyType]crypto.PrivateKey)
+	generatedKeysM sync.Mutex
+)
+
+func genPrivateKey(typ KeyType) (crypto.PrivateKey, error) {
+	switch typ {
+	case KeyECDSAP224:
+		return ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyECDSAP521:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case KeyED25519:
+		_, prv, err := ed25519.GenerateKey(rand.Reader)
+		return prv, err
+	case KeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
 	}
-	r4096, err := rsa.GenerateKey(rand.Reader, 4096)
-	if err == nil {
-		keys = append(keys, r4096)
+	return nil, errf("unknown key type %d", typ)
+}
+
+// genPrivateKeys returns one private key for each of the key types.
+func genPrivateKeys(types KeyType) []crypto.PrivateKey {
+	generatedKeysM.Lock()
+	defer generatedKeysM.Unlock()
+
+	keys := make([]crypto.PrivateKey, 0, 7)
+	for typ := KeyECDSAP224; typ <= KeyRSA4096; typ <<= 1 {
+		if types&typ != typ {
+			continue
+		}
+		key, ok := generatedKeys[typ]
+		if !ok {
+			var err error
+			if key, err = genPrivateKey(typ); err != nil {
+				continue
+			}
+			generatedKeys[typ] = key
+		}
+		keys = append(keys, key)
 	}
 	return keys
 }
 
+// randomPrivateKey returns one of the private keys of the types the runner is configured with.
+func (r *runner) randomPrivateKey() crypto.PrivateKey {
+	keys := genPrivateKeys(r.conf.keyTypes)
+	return keys[r.rand.IntN(len(keys))]
+}
+
 func publicKey(key crypto.PrivateKey) (crypto.PublicKey, bool) {
 	var pub crypto.PublicKey
 	valid := true
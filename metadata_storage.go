@@ -119,19 +119,19 @@ func (p PassAndKeyMetadata) MarshalJSON() ([]byte, error) {
 
 var validPwChars = `abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()_+[]\{}|;':",./<>?`
 
-func getRandomPw() string {
+func getRandomPw(rnd *rand.Rand) string {
 	ss := strings.Builder{}
-	for range 8 + rand.IntN(32) {
-		ss.WriteRune(rune(validPwChars[rand.IntN(len(validPwChars))]))
+	for range 8 + rnd.IntN(32) {
+		ss.WriteRune(rune(validPwChars[rnd.IntN(len(validPwChars))]))
 	}
 	return ss.String()
 }
 
-func buildMetaData() []json.Marshaler {
+func (r *runner) buildMetaData() []json.Marshaler {
 	result := make([]json.Marshaler, 0)
 	result = append(result, PassAndKeyMetadata{
-		Pw:  getRandomPw(),
-		Key: getPrivateKey(),
+		Pw:  getRandomPw(r.rand),
+		Key: r.randomPrivateKey(),
 	})
 	//result = append(result, )
 	//result = append(result, 123.6666)
@@ -139,25 +139,39 @@ func buildMetaData() []json.Marshaler {
 	return result
 }
 
-func RunMetadataTests(t *testing.T, storage ActivityPubStorage) {
+func mockMetadataStorage(t *testing.T, newStorage StorageFactory) MetadataStorage {
+	t.Helper()
+
+	storage := mockActivityPub(t, newStorage)
 	mStorage, ok := storage.(MetadataStorage)
-	if !ok {
-		t.Skipf("storage %T is not compatible with MetaData functionality", storage)
-	}
+	requireCapability(t, storage, CapabilityMetadata, ok)
+	return mStorage
+}
+
+func RunMetadataTests(t *testing.T, storage ActivityPubStorage, opts ...Option) {
+	newRunner(sharedStorage(storage), opts...).start(t).runMetadataTests(t)
+}
+
+func (r *runner) runMetadataTests(t *testing.T) {
+	_ = mockMetadataStorage(t, r.newStorage)
+	r.parallel(t)
 
 	{
 		toSave := PassAndKeyMetadata{
-			Pw:  getRandomPw(),
-			Key: getPrivateKey(),
+			Pw:  getRandomPw(r.rand),
+			Key: r.randomPrivateKey(),
 		}
-		t.Run(fmt.Sprintf("store %T", toSave), func(t *testing.T) {
-			if err := mStorage.SaveMetadata(gen.RootID, toSave); err != nil {
+		iri := r.partitionIRI(gen.RootID, "meta-pass-and-key")
+		r.require(t, fmt.Sprintf("store %T", toSave), reqMetadataRoundTrip, func(t *check) {
+			r.parallel(t.T)
+			mStorage := mockMetadataStorage(t.T, r.newStorage)
+			if err := mStorage.SaveMetadata(iri, toSave); err != nil {
 				t.Errorf("unable to save Metadata %T: %s", toSave, err)
 			}
 
 			loadInto := PassAndKeyMetadata{}
-			if err := mStorage.LoadMetadata(gen.RootID, &loadInto); err != nil {
-				t.Errorf("unable to load metadata %T for iri %s: %s", toSave, gen.RootID, err)
+			if err := mStorage.LoadMetadata(iri, &loadInto); err != nil {
+				t.Errorf("unable to load metadata %T for iri %s: %s", toSave, iri, err)
 			}
 			if !cmp.Equal(toSave, loadInto) {
 				t.Errorf("loaded metadata is not equal: %s", cmp.Diff(toSave, loadInto))
@@ -166,14 +180,17 @@ func RunMetadataTests(t *testing.T, storage ActivityPubStorage) {
 	}
 	{
 		toStore := struct{ A string }{A: "lorem ipsum, dolor sic amet"}
-		t.Run(fmt.Sprintf("store %T", toStore), func(t *testing.T) {
-			if err := mStorage.SaveMetadata(gen.RootID, toStore); err != nil {
+		iri := r.partitionIRI(gen.RootID, "meta-struct")
+		r.require(t, fmt.Sprintf("store %T", toStore), reqMetadataRoundTrip, func(t *check) {
+			r.parallel(t.T)
+			mStorage := mockMetadataStorage(t.T, r.newStorage)
+			if err := mStorage.SaveMetadata(iri, toStore); err != nil {
 				t.Errorf("unable to save Metadata %T: %s", toStore, err)
 			}
 
 			loadInto := struct{ A string }{}
-			if err := mStorage.LoadMetadata(gen.RootID, &loadInto); err != nil {
-				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, gen.RootID, err)
+			if err := mStorage.LoadMetadata(iri, &loadInto); err != nil {
+				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, iri, err)
 			}
 			if !cmp.Equal(toStore, loadInto) {
 				t.Errorf("loaded metadata is not equal: %s", cmp.Diff(toStore, loadInto))
@@ -182,14 +199,17 @@ func RunMetadataTests(t *testing.T, storage ActivityPubStorage) {
 	}
 	{
 		toStore := 6666
-		t.Run(fmt.Sprintf("store %T", toStore), func(t *testing.T) {
-			if err := mStorage.SaveMetadata(gen.RootID, toStore); err != nil {
+		iri := r.partitionIRI(gen.RootID, "meta-int")
+		r.require(t, fmt.Sprintf("store %T", toStore), reqMetadataRoundTrip, func(t *check) {
+			r.parallel(t.T)
+			mStorage := mockMetadataStorage(t.T, r.newStorage)
+			if err := mStorage.SaveMetadata(iri, toStore); err != nil {
 				t.Errorf("unable to save Metadata %T: %s", toStore, err)
 			}
 
 			var loadInto int
-			if err := mStorage.LoadMetadata(gen.RootID, &loadInto); err != nil {
-				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, gen.RootID, err)
+			if err := mStorage.LoadMetadata(iri, &loadInto); err != nil {
+				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, iri, err)
 			}
 			if !cmp.Equal(toStore, loadInto) {
 				t.Errorf("loaded metadata is not equal: %s", cmp.Diff(toStore, loadInto))
@@ -198,14 +218,17 @@ func RunMetadataTests(t *testing.T, storage ActivityPubStorage) {
 	}
 	{
 		toStore := 0.1111111
-		t.Run(fmt.Sprintf("store %T", toStore), func(t *testing.T) {
-			if err := mStorage.SaveMetadata(gen.RootID, toStore); err != nil {
+		iri := r.partitionIRI(gen.RootID, "meta-float")
+		r.require(t, fmt.Sprintf("store %T", toStore), reqMetadataRoundTrip, func(t *check) {
+			r.parallel(t.T)
+			mStorage := mockMetadataStorage(t.T, r.newStorage)
+			if err := mStorage.SaveMetadata(iri, toStore); err != nil {
 				t.Errorf("unable to save Metadata %T: %s", toStore, err)
 			}
 
 			var loadInto float64
-			if err := mStorage.LoadMetadata(gen.RootID, &loadInto); err != nil {
-				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, gen.RootID, err)
+			if err := mStorage.LoadMetadata(iri, &loadInto); err != nil {
+				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, iri, err)
 			}
 			if !cmp.Equal(toStore, loadInto) {
 				t.Errorf("loaded metadata is not equal: %s", cmp.Diff(toStore, loadInto))
@@ -214,14 +237,17 @@ func RunMetadataTests(t *testing.T, storage ActivityPubStorage) {
 	}
 	{
 		toStore := []byte("Lorem ipsum dolor sic amet")
-		t.Run(fmt.Sprintf("store %T", toStore), func(t *testing.T) {
-			if err := mStorage.SaveMetadata(gen.RootID, toStore); err != nil {
+		iri := r.partitionIRI(gen.RootID, "meta-bytes")
+		r.require(t, fmt.Sprintf("store %T", toStore), reqMetadataRoundTrip, func(t *check) {
+			r.parallel(t.T)
+			mStorage := mockMetadataStorage(t.T, r.newStorage)
+			if err := mStorage.SaveMetadata(iri, toStore); err != nil {
 				t.Errorf("unable to save Metadata %T: %s", toStore, err)
 			}
 
 			var loadInto []byte
-			if err := mStorage.LoadMetadata(gen.RootID, &loadInto); err != nil {
-				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, gen.RootID, err)
+			if err := mStorage.LoadMetadata(iri, &loadInto); err != nil {
+				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, iri, err)
 			}
 			if !cmp.Equal(toStore, loadInto) {
 				t.Errorf("loaded metadata is not equal: %s", cmp.Diff(toStore, loadInto))
@@ -230,14 +256,17 @@ func RunMetadataTests(t *testing.T, storage ActivityPubStorage) {
 	}
 	{
 		toStore := "Lorem ipsum dolor sic amet"
-		t.Run(fmt.Sprintf("store %T", toStore), func(t *testing.T) {
-			if err := mStorage.SaveMetadata(gen.RootID, toStore); err != nil {
+		iri := r.partitionIRI(gen.RootID, "meta-string")
+		r.require(t, fmt.Sprintf("store %T", toStore), reqMetadataRoundTrip, func(t *check) {
+			r.parallel(t.T)
+			mStorage := mockMetadataStorage(t.T, r.newStorage)
+			if err := mStorage.SaveMetadata(iri, toStore); err != nil {
 				t.Errorf("unable to save Metadata %T: %s", toStore, err)
 			}
 
 			var loadInto string
-			if err := mStorage.LoadMetadata(gen.RootID, &loadInto); err != nil {
-				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, gen.RootID, err)
+			if err := mStorage.LoadMetadata(iri, &loadInto); err != nil {
+				t.Errorf("unable to load metadata %T for iri %s: %s", toStore, iri, err)
 			}
 			if !cmp.Equal(toStore, loadInto) {
 				t.Errorf("loaded metadata is not equal: %s", cmp.Diff(toStore, loadInto))
@@ -86,29 +86,41 @@ func accessDataEqual(a1, a2 *osin.AccessData) bool {
 	return cmp.Equal(a1, a2)
 }
 
-func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
+func mockOAuthStorage(t *testing.T, newStorage StorageFactory) OSINStorage {
+	t.Helper()
+
+	storage := newStorage(t)
 	oStorage, ok := storage.(OSINStorage)
-	if !ok {
-		t.Skipf("storage %T is not compatible with OAuth2 operations", storage)
-	}
+	requireCapability(t, storage, CapabilityOAuth, ok)
+	return oStorage
+}
+
+func RunOAuthTests(t *testing.T, storage ActivityPubStorage, opts ...Option) {
+	newRunner(sharedStorage(storage), opts...).start(t).runOAuthTests(t)
+}
+
+func (r *runner) runOAuthTests(t *testing.T) {
+	_ = mockOAuthStorage(t, r.newStorage)
+	// NOTE(marius): the OAuth2 tests share the client, and the authorization codes and tokens,
+	// so only the group runs concurrently with the others, not the tests in it.
+	r.parallel(t)
 
-	t.Run("client operations", func(t *testing.T) {
+	r.run(t, "client operations", func(t *testing.T) {
+		oStorage := mockOAuthStorage(t, r.newStorage)
 		saver, ok := oStorage.(ClientSaver)
-		if !ok {
-			t.Skipf("storage %T is not compatible with OAuth2 client saver operations", storage)
-		}
+		requireCapability(t, oStorage, CapabilityOAuthClientSaver, ok)
 		client := osin.DefaultClient{
 			Id:          "test",
 			Secret:      "asd",
 			RedirectUri: "http://127.0.0.1",
 			UserData:    "https://example.com/~jdoe",
 		}
-		t.Run("save client", func(t *testing.T) {
+		r.require(t, "save client", reqOAuthClient, func(t *check) {
 			if err := saver.SaveClient(&client); err != nil {
 				t.Errorf("unable to save new client: %s", err)
 			}
 		})
-		t.Run("get client", func(t *testing.T) {
+		r.require(t, "get client", reqOAuthClient, func(t *check) {
 			loaded, err := oStorage.GetClient(client.Id)
 			if err != nil {
 				t.Errorf("unable to load client: %s", err)
@@ -117,11 +129,9 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 				t.Errorf("invalid client returned from loading %s", cmp.Diff(&client, loaded))
 			}
 		})
-		t.Run("list clients", func(t *testing.T) {
+		r.require(t, "list clients", reqOAuthClientList, func(t *check) {
 			loader, ok := oStorage.(ClientLister)
-			if !ok {
-				t.Skipf("storage %T is not compatible with Client Listing", oStorage)
-			}
+			requireCapability(t.T, oStorage, CapabilityOAuthClientLister, ok)
 			clients, err := loader.ListClients()
 			if err != nil {
 				t.Errorf("unable to list clients: %s", err)
@@ -133,7 +143,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 				t.Errorf("invalid client returned from loading %s", cmp.Diff(&client, clients[0]))
 			}
 		})
-		t.Run("update client", func(t *testing.T) {
+		r.require(t, "update client", reqOAuthClient, func(t *check) {
 			toUpdate := *(&client)
 			toUpdate.RedirectUri = "https://127.0.0.1"
 			toUpdate.Secret = "dsa"
@@ -149,7 +159,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 				t.Errorf("invalid client returned from loading %s", cmp.Diff(&toUpdate, loaded))
 			}
 		})
-		t.Run("delete client", func(t *testing.T) {
+		r.require(t, "delete client", reqOAuthClient, func(t *check) {
 			if err := saver.RemoveClient(client.Id); err != nil {
 				t.Errorf("unable to remove client: %s", err)
 			}
@@ -162,7 +172,9 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 			}
 		})
 	})
-	t.Run("authorize operations", func(t *testing.T) {
+	r.run(t, "authorize operations", func(t *testing.T) {
+		oStorage := mockOAuthStorage(t, r.newStorage)
+
 		client := osin.DefaultClient{
 			Id:          "test",
 			Secret:      "asd",
@@ -185,12 +197,12 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 			CodeChallengeMethod: "S256",
 			CodeChallenge:       "1000000000000000000000000000000000000000666",
 		}
-		t.Run("save authorize", func(t *testing.T) {
+		r.require(t, "save authorize", reqOAuthAuthorize, func(t *check) {
 			if err := oStorage.SaveAuthorize(&auth); err != nil {
 				t.Errorf("unable to save authorize data: %s", err)
 			}
 		})
-		t.Run("load authorize", func(t *testing.T) {
+		r.require(t, "load authorize", reqOAuthAuthorize, func(t *check) {
 			loaded, err := oStorage.LoadAuthorize(auth.Code)
 			if err != nil {
 				t.Errorf("unable to load authorize data: %s", err)
@@ -199,7 +211,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 				t.Errorf("invalid authorize data returned from loading %s", cmp.Diff(&auth, loaded))
 			}
 		})
-		t.Run("remove authorize", func(t *testing.T) {
+		r.require(t, "remove authorize", reqOAuthAuthorize, func(t *check) {
 			err := oStorage.RemoveAuthorize(auth.Code)
 			if err != nil {
 				t.Errorf("unable to load authorize data: %s", err)
@@ -213,7 +225,9 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 			}
 		})
 	})
-	t.Run("access operations", func(t *testing.T) {
+	r.run(t, "access operations", func(t *testing.T) {
+		oStorage := mockOAuthStorage(t, r.newStorage)
+
 		client := osin.DefaultClient{
 			Id:          "test",
 			Secret:      "asd",
@@ -259,7 +273,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 			CreatedAt:    someDate,
 			UserData:     vocab.IRI("https://example.com/~johndoe"),
 		}
-		t.Run("save access data", func(t *testing.T) {
+		r.require(t, "save access data", reqOAuthAccess, func(t *check) {
 			//if err := oStorage.SaveAccess(&refresh); err != nil {
 			//	t.Errorf("unable to save access data: %s", err)
 			//}
@@ -267,7 +281,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 				t.Errorf("unable to save access data: %s", err)
 			}
 		})
-		t.Run("load access data", func(t *testing.T) {
+		r.require(t, "load access data", reqOAuthAccess, func(t *check) {
 			loaded, err := oStorage.LoadAccess(access.AccessToken)
 			if err != nil {
 				t.Errorf("unable to load access data: %s", err)
@@ -276,7 +290,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 				t.Errorf("invalid access data returned from loading %s", cmp.Diff(&access, loaded))
 			}
 		})
-		t.Run("remove access data", func(t *testing.T) {
+		r.require(t, "remove access data", reqOAuthAccess, func(t *check) {
 			if err := oStorage.RemoveAccess(access.AccessToken); err != nil {
 				t.Errorf("unable to remove access data: %s", err)
 			}
@@ -289,7 +303,9 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 			}
 		})
 	})
-	t.Run("refresh operations", func(t *testing.T) {
+	r.run(t, "refresh operations", func(t *testing.T) {
+		oStorage := mockOAuthStorage(t, r.newStorage)
+
 		client := osin.DefaultClient{
 			Id:          "test",
 			Secret:      "asd",
@@ -323,7 +339,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 			UserData:      vocab.IRI("https://example.com/~johndoe"),
 		}
 		_ = oStorage.SaveAccess(&access)
-		t.Run("load refresh data", func(t *testing.T) {
+		r.require(t, "load refresh data", reqOAuthRefresh, func(t *check) {
 			loaded, err := oStorage.LoadRefresh(access.RefreshToken)
 			if err != nil {
 				t.Errorf("unable to load refresh data: %s", err)
@@ -332,7 +348,7 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 				t.Errorf("invalid refresh access data loaded %s", cmp.Diff(&access, loaded))
 			}
 		})
-		t.Run("remove refresh data", func(t *testing.T) {
+		r.require(t, "remove refresh data", reqOAuthRefresh, func(t *check) {
 			if err := oStorage.RemoveRefresh(access.RefreshToken); err != nil {
 				t.Errorf("unable to remove refresh data: %s", err)
 			}
@@ -345,11 +361,11 @@ func RunOAuthTests(t *testing.T, storage ActivityPubStorage) {
 			}
 		})
 	})
-	t.Run("clone storage", func(t *testing.T) {
+	r.run(t, "clone storage", func(t *testing.T) {
 		t.Skipf("%s", errNotImplemented)
 	})
 
-	t.Run("close storage", func(t *testing.T) {
+	r.run(t, "close storage", func(t *testing.T) {
 		t.Skipf("%s", errNotImplemented)
 	})
 }
@@ -0,0 +1,261 @@
+package conformance
+
+import (
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option configures how the suite runs.
+type Option func(*config)
+
+type config struct {
+	// objects is the number of random objects the ActivityPub tests get executed with.
+	objects int
+	// keyTypes are the types of private keys the Key tests save and load.
+	keyTypes KeyType
+	// seed initializes the source of randomness of the suite. When zero, a random one is used.
+	seed uint64
+	// levels are the requirement levels which get checked, the checks for the other ones are skipped.
+	levels []Level
+	// timeout is the maximum duration of each test group. When zero, the groups have no time limit.
+	timeout time.Duration
+	// pageSizes are the maximum numbers of items per page for the pagination tests.
+	// When empty, collections get loaded with pages of 10 items, and traversed with all the possible page sizes.
+	pageSizes []int
+	// parallel makes the independent test groups and tests run concurrently.
+	parallel bool
+	// lenient makes failures of SHOULD requirements only log warnings, instead of failing the tests.
+	lenient bool
+	// maxContentSize is the size in bytes of the largest content the size boundary tests save.
+	maxContentSize int
+	// maxAttachments is the largest number of attachments the size boundary tests save.
+	maxAttachments int
+	// maxIRILength is the length of the longest collection IRI the size boundary tests save.
+	maxIRILength int
+}
+
+// SeedEnv is the environment variable which can contain the seed of a previous run, to reproduce it.
+// It takes precedence over the WithSeed option.
+const SeedEnv = "CONFORMANCE_SEED"
+
+// ParallelEnv is the environment variable which, when set to a true value, enables the parallel mode.
+const ParallelEnv = "CONFORMANCE_PARALLEL"
+
+const defaultObjectCount = 64
+
+const (
+	defaultMaxContentSize = 1 << 20
+	defaultMaxAttachments = 1024
+	defaultMaxIRILength   = 2048
+)
+
+func defaultConfig() config {
+	return config{
+		objects:        defaultObjectCount,
+		keyTypes:       KeyTypesAll,
+		levels:         []Level{LevelMust, LevelShould, LevelMay},
+		maxContentSize: defaultMaxContentSize,
+		maxAttachments: defaultMaxAttachments,
+		maxIRILength:   defaultMaxIRILength,
+	}
+}
+
+func newConfig(opts ...Option) config {
+	conf := defaultConfig()
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if seed, err := strconv.ParseUint(os.Getenv(SeedEnv), 10, 64); err == nil && seed != 0 {
+		conf.seed = seed
+	}
+	if conf.seed == 0 {
+		conf.seed = rand.Uint64()
+	}
+	if parallel, err := strconv.ParseBool(os.Getenv(ParallelEnv)); err == nil && parallel {
+		conf.parallel = true
+	}
+	if strings.EqualFold(os.Getenv(ModeEnv), "lenient") {
+		conf.lenient = true
+	}
+	return conf
+}
+
+// WithObjects sets the number of random objects the ActivityPub tests get executed with.
+func WithObjects(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.objects = n
+		}
+	}
+}
+
+// WithKeyTypes sets the types of private keys the Key tests save and load.
+func WithKeyTypes(types KeyType) Option {
+	return func(c *config) {
+		if types != 0 {
+			c.keyTypes = types
+		}
+	}
+}
+
+// WithSeed sets the seed for the source of randomness of the suite and of the generated test data,
+// so a run can be reproduced.
+func WithSeed(seed uint64) Option {
+	return func(c *config) {
+		c.seed = seed
+	}
+}
+
+// WithLevels sets the requirement levels to check, the checks for requirements with other levels get skipped.
+func WithLevels(levels ...Level) Option {
+	return func(c *config) {
+		if len(levels) > 0 {
+			c.levels = levels
+		}
+	}
+}
+
+// WithTimeout sets the maximum duration of each test group.
+// The checks still running when it elapses fail without waiting for them to finish,
+// and the ones that start after it elapsed fail without being executed.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithPageSizes sets the maximum numbers of items per page used for loading and traversing collections.
+func WithPageSizes(sizes ...int) Option {
+	return func(c *config) {
+		c.pageSizes = slices.DeleteFunc(slices.Clone(sizes), func(s int) bool {
+			return s <= 0
+		})
+	}
+}
+
+// WithMaxContentSize sets the size in bytes of the largest content the size boundary tests try to save.
+// They start with 1KB of content, and increase it eight times at every step, up to this size.
+func WithMaxContentSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.maxContentSize = size
+		}
+	}
+}
+
+// WithMaxAttachments sets the largest number of attachments the size boundary tests try to save.
+// They start with 16 attachments, and increase their number four times at every step, up to this one.
+func WithMaxAttachments(count int) Option {
+	return func(c *config) {
+		if count > 0 {
+			c.maxAttachments = count
+		}
+	}
+}
+
+// WithMaxIRILength sets the length of the longest collection IRI the size boundary tests try to save.
+// They start with IRIs of 256 characters, and increase their length four times at every step, up to this one.
+func WithMaxIRILength(length int) Option {
+	return func(c *config) {
+		if length > 0 {
+			c.maxIRILength = length
+		}
+	}
+}
+
+// WithParallel makes the independent test groups, and the independent tests in them, run concurrently
+// against the storage, which needs to be safe for concurrent use.
+// Every one of the concurrent tests works on its own data, so their results don't depend on the order they run in.
+func WithParallel() Option {
+	return func(c *config) {
+		c.parallel = true
+	}
+}
+
+// WithLenient makes the failures of SHOULD requirements only log warnings, like the ones of MAY requirements,
+// instead of failing the tests. It has the same effect as setting the CONFORMANCE_MODE environment variable
+// to "lenient".
+func WithLenient() Option {
+	return func(c *config) {
+		c.lenient = true
+	}
+}
+
+// Smoke is a small profile, suitable for running on every change of slow backends.
+func Smoke() Option {
+	return func(c *config) {
+		WithObjects(16)(c)
+		WithKeyTypes(KeyECDSAP256 | KeyED25519 | KeyRSA2048)(c)
+		WithPageSizes(1, 5, 10)(c)
+		WithMaxContentSize(64 << 10)(c)
+		WithMaxAttachments(64)(c)
+		WithMaxIRILength(512)(c)
+	}
+}
+
+// Nightly is a large profile, which exercises backends with a bigger dataset and all the key types.
+func Nightly() Option {
+	return func(c *config) {
+		WithObjects(512)(c)
+		WithKeyTypes(KeyTypesAll)(c)
+		WithPageSizes(1, 2, 3, 5, 7, 10, 16, 32, 50, 64, 100, 128, 256, 500, 512, 513)(c)
+		WithMaxContentSize(64 << 20)(c)
+		WithMaxAttachments(65536)(c)
+		WithMaxIRILength(65536)(c)
+	}
+}
+
+func (c config) enabled(lvl Level) bool {
+	return slices.Contains(c.levels, lvl)
+}
+
+// queryPageSizes returns the page sizes used for loading collections with pagination filters.
+func (c config) queryPageSizes() []int {
+	if len(c.pageSizes) == 0 {
+		return []int{10}
+	}
+	return c.pageSizes
+}
+
+// traversalPageSizes returns the page sizes used for traversing a collection of "total" items.
+func (c config) traversalPageSizes(total int) []int {
+	if len(c.pageSizes) > 0 {
+		return c.pageSizes
+	}
+	sizes := make([]int, 0, total+1)
+	for idx := range total + 1 {
+		sizes = append(sizes, idx+1)
+	}
+	return sizes
+}
+
+// probeSizes returns the sizes probed by the size boundary tests, in increasing order: "start", multiplied
+// by "factor" at every step, up to "last". The "baseline" size every storage needs to accept, and "last",
+// are always included.
+func probeSizes(start, factor, baseline, last int) []int {
+	sizes := []int{baseline, last}
+	for size := start; size < last; size *= factor {
+		sizes = append(sizes, size)
+	}
+	slices.Sort(sizes)
+	return slices.Compact(sizes)
+}
+
+// contentSizes returns the sizes of the content saved by the size boundary tests.
+func (c config) contentSizes() []int {
+	return probeSizes(1<<10, 8, baselineContentSize, c.maxContentSize)
+}
+
+// attachmentCounts returns the numbers of attachments saved by the size boundary tests.
+func (c config) attachmentCounts() []int {
+	return probeSizes(16, 4, baselineAttachments, c.maxAttachments)
+}
+
+// iriLengths returns the lengths of the collection IRIs saved by the size boundary tests.
+func (c config) iriLengths() []int {
+	return probeSizes(256, 4, baselineIRILength, c.maxIRILength)
+}
@@ -0,0 +1,98 @@
+package conformance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_newConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want config
+	}{
+		{
+			name: "defaults",
+			opts: []Option{WithSeed(1)},
+			want: config{objects: defaultObjectCount, keyTypes: KeyTypesAll, seed: 1, levels: []Level{LevelMust, LevelShould, LevelMay}, maxContentSize: defaultMaxContentSize, maxAttachments: defaultMaxAttachments, maxIRILength: defaultMaxIRILength},
+		},
+		{
+			name: "smoke",
+			opts: []Option{Smoke(), WithSeed(2), WithTimeout(time.Minute)},
+			want: config{
+				objects:        16,
+				keyTypes:       KeyECDSAP256 | KeyED25519 | KeyRSA2048,
+				seed:           2,
+				levels:         []Level{LevelMust, LevelShould, LevelMay},
+				timeout:        time.Minute,
+				pageSizes:      []int{1, 5, 10},
+				maxContentSize: 64 << 10,
+				maxAttachments: 64,
+				maxIRILength:   512,
+			},
+		},
+		{
+			name: "invalid values are ignored",
+			opts: []Option{WithSeed(3), WithObjects(-1), WithKeyTypes(0), WithLevels(), WithPageSizes(0, -2, 4), WithMaxContentSize(-1), WithMaxAttachments(0), WithMaxIRILength(-1)},
+			want: config{objects: defaultObjectCount, keyTypes: KeyTypesAll, seed: 3, levels: []Level{LevelMust, LevelShould, LevelMay}, pageSizes: []int{4}, maxContentSize: defaultMaxContentSize, maxAttachments: defaultMaxAttachments, maxIRILength: defaultMaxIRILength},
+		},
+		{
+			name: "lenient",
+			opts: []Option{WithSeed(5), WithLenient()},
+			want: config{objects: defaultObjectCount, keyTypes: KeyTypesAll, seed: 5, levels: []Level{LevelMust, LevelShould, LevelMay}, maxContentSize: defaultMaxContentSize, maxAttachments: defaultMaxAttachments, maxIRILength: defaultMaxIRILength, lenient: true},
+		},
+		{
+			name: "only MUST",
+			opts: []Option{WithSeed(4), WithLevels(LevelMust)},
+			want: config{objects: defaultObjectCount, keyTypes: KeyTypesAll, seed: 4, levels: []Level{LevelMust}, maxContentSize: defaultMaxContentSize, maxAttachments: defaultMaxAttachments, maxIRILength: defaultMaxIRILength},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newConfig(tt.opts...)
+			if !cmp.Equal(tt.want, got, cmp.AllowUnexported(config{})) {
+				t.Errorf("newConfig() = %s", cmp.Diff(tt.want, got, cmp.AllowUnexported(config{})))
+			}
+		})
+	}
+}
+
+func Test_newConfig_randomSeed(t *testing.T) {
+	if conf := newConfig(); conf.seed == 0 {
+		t.Errorf("expected a random seed to be generated")
+	}
+}
+
+func Test_config_traversalPageSizes(t *testing.T) {
+	if got := newConfig().traversalPageSizes(3); !cmp.Equal(got, []int{1, 2, 3, 4}) {
+		t.Errorf("invalid default traversal page sizes %v", got)
+	}
+	if got := newConfig(WithPageSizes(2, 7)).traversalPageSizes(3); !cmp.Equal(got, []int{2, 7}) {
+		t.Errorf("invalid traversal page sizes %v", got)
+	}
+}
+
+func Test_genPrivateKeys(t *testing.T) {
+	keys := genPrivateKeys(KeyECDSAP256 | KeyED25519)
+	if len(keys) != 2 {
+		t.Fatalf("invalid number of keys %d, expected 2", len(keys))
+	}
+	again := genPrivateKeys(KeyECDSAP256)
+	if len(again) != 1 || again[0] != keys[0] {
+		t.Errorf("expected the generated keys to be reused")
+	}
+}
+
+func Test_probeSizes(t *testing.T) {
+	if got := probeSizes(16, 4, 64, 1024); !cmp.Equal(got, []int{16, 64, 256, 1024}) {
+		t.Errorf("invalid probe sizes %v", got)
+	}
+	if got := probeSizes(256, 4, 512, 2048); !cmp.Equal(got, []int{256, 512, 1024, 2048}) {
+		t.Errorf("invalid probe sizes %v", got)
+	}
+	if got := probeSizes(1<<10, 8, 64<<10, 512); !cmp.Equal(got, []int{512, 64 << 10}) {
+		t.Errorf("invalid probe sizes %v", got)
+	}
+}
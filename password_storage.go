@@ -22,18 +22,22 @@ func initPasswordStorage(storage PasswordStorage) error {
 	return nil
 }
 
-func RunPasswordTests(t *testing.T, storage ActivityPubStorage) {
+func RunPasswordTests(t *testing.T, storage ActivityPubStorage, opts ...Option) {
+	newRunner(sharedStorage(storage), opts...).start(t).runPasswordTests(t)
+}
+
+func (r *runner) runPasswordTests(t *testing.T) {
+	r.parallel(t)
+	storage := mockActivityPub(t, r.newStorage)
 	pwStorage, ok := storage.(PasswordStorage)
-	if !ok {
-		t.Skipf("storage %T is not compatible with Password operations", storage)
-	}
+	requireCapability(t, storage, CapabilityPasswords, ok)
 
 	if err := initPasswordStorage(pwStorage); err != nil {
 		t.Errorf("unable to init Password test suite: %s", err)
 		return
 	}
 
-	t.Run("check Root password", func(t *testing.T) {
+	r.require(t, "check Root password", reqPasswordCheck, func(t *check) {
 		if err := pwStorage.PasswordCheck(gen.RootID, rootPw); err != nil {
 			t.Errorf("unable to validate root password: %s", err)
 		}
@@ -0,0 +1,319 @@
+package conformance
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ReportEnv is the environment variable that can contain a comma separated list of paths
+// where the results of the suite get written.
+// Paths with the ".xml" extension get a JUnit XML report, all others get a JSON one.
+const ReportEnv = "CONFORMANCE_REPORT"
+
+const modulePath = "github.com/go-ap/storage-conformance-suite"
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+	// StatusWarn is the status of failed checks for requirements which are not mandatory.
+	StatusWarn Status = "warn"
+)
+
+// Result is the outcome of one of the tests executed by the suite.
+type Result struct {
+	Name        string        `json:"name"`
+	Requirement string        `json:"requirement,omitempty"`
+	Level       string        `json:"level,omitempty"`
+	Status      Status        `json:"status"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Report contains the results of running the suite against a storage backend.
+type Report struct {
+	Backend      string        `json:"backend"`
+	SuiteVersion string        `json:"suiteVersion"`
+	Started      time.Time     `json:"started"`
+	Duration     time.Duration `json:"duration"`
+	Results      []Result      `json:"results"`
+	// Level is the conformance level computed from the results when the run finished.
+	Level ConformanceLevel `json:"level,omitempty"`
+	// Limits are the largest sizes the backend accepted in the size boundary tests, by their name.
+	Limits map[string]int `json:"limits,omitempty"`
+
+	m sync.Mutex
+}
+
+func newReport() *Report {
+	return &Report{
+		SuiteVersion: suiteVersion(),
+		Started:      time.Now().UTC(),
+		Results:      make([]Result, 0),
+	}
+}
+
+// suiteVersion returns the version of the conformance suite module the test binary was built with.
+func suiteVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if bi.Main.Path == modulePath {
+		return bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil {
+			return "(devel)"
+		}
+		return dep.Version
+	}
+	return "unknown"
+}
+
+func (r *Report) setBackend(storage any) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.Backend == "" {
+		r.Backend = fmt.Sprintf("%T", storage)
+	}
+}
+
+func testResult(t *testing.T, started time.Time) Result {
+	res := Result{
+		Name:     t.Name(),
+		Status:   StatusPass,
+		Duration: time.Since(started),
+	}
+	switch {
+	case t.Failed():
+		res.Status = StatusFail
+	case t.Skipped():
+		res.Status = StatusSkip
+	}
+	return res
+}
+
+func (r *Report) append(res Result) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.Results = append(r.Results, res)
+}
+
+func (r *Report) record(t *testing.T, started time.Time) {
+	r.append(testResult(t, started))
+}
+
+func (r *Report) recordCheck(c *check, started time.Time) {
+	res := testResult(c.T, started)
+	res.Requirement = c.req.ID
+	res.Level = c.req.Level.String()
+	if c.warned && !c.T.Failed() {
+		res.Status = StatusWarn
+	}
+	r.append(res)
+}
+
+// recordLimit records "size" as accepted for the "name" limit, if it's larger than the ones recorded before.
+func (r *Report) recordLimit(name string, size int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.Limits == nil {
+		r.Limits = make(map[string]int)
+	}
+	r.Limits[name] = max(r.Limits[name], size)
+}
+
+func (r *Report) finish() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.Duration = time.Since(r.Started)
+	r.conclude()
+}
+
+func (r *Report) conclude() {
+	slices.SortStableFunc(r.Results, func(a, b Result) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	r.Level = conformanceLevel(r.summary())
+}
+
+// Merge adds the results of the other reports to r, and computes the conformance level of the combined results.
+// It is useful for backends which run the suite from more than one test.
+func (r *Report) Merge(others ...*Report) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, o := range others {
+		if r.Backend == "" {
+			r.Backend = o.Backend
+		}
+		if r.SuiteVersion == "" {
+			r.SuiteVersion = o.SuiteVersion
+		}
+		if r.Started.IsZero() || (!o.Started.IsZero() && o.Started.Before(r.Started)) {
+			r.Started = o.Started
+		}
+		r.Duration += o.Duration
+		r.Results = append(r.Results, o.Results...)
+		for name, size := range o.Limits {
+			if r.Limits == nil {
+				r.Limits = make(map[string]int)
+			}
+			r.Limits[name] = max(r.Limits[name], size)
+		}
+	}
+	r.conclude()
+}
+
+// Count returns the number of results with status "st".
+func (r *Report) Count(st Status) int {
+	cnt := 0
+	for _, res := range r.Results {
+		if res.Status == st {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      r.Backend,
+		Tests:     len(r.Results),
+		Failures:  r.Count(StatusFail),
+		Skipped:   r.Count(StatusSkip),
+		Time:      junitTime(r.Duration),
+		Timestamp: r.Started.Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "backend", Value: r.Backend},
+			{Name: "suiteVersion", Value: r.SuiteVersion},
+		},
+		Cases: make([]junitTestCase, 0, len(r.Results)),
+	}
+	for _, res := range r.Results {
+		// NOTE(marius): the class name is the top level test and the group, eg: "Test_Conformance/ActivityPub_tests"
+		className, name := res.Name, res.Name
+		if pieces := strings.SplitN(res.Name, "/", 3); len(pieces) == 3 {
+			className = pieces[0] + "/" + pieces[1]
+			name = pieces[2]
+		}
+		tc := junitTestCase{
+			Name:      name,
+			ClassName: className,
+			Time:      junitTime(res.Duration),
+		}
+		switch res.Status {
+		case StatusFail:
+			tc.Failure = &junitMessage{Message: strings.TrimSpace(fmt.Sprintf("%s %s failed", res.Level, res.Requirement))}
+		case StatusSkip:
+			tc.Skipped = &junitMessage{Message: "skipped"}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}})
+}
+
+// Save writes the report to "path", as JUnit XML if the file has the ".xml" extension, or as JSON otherwise.
+func (r *Report) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		return r.WriteJUnit(f)
+	}
+	return r.WriteJSON(f)
+}
+
+// LoadReport reads a JSON report previously written by the suite.
+func LoadReport(path string) (*Report, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Report)
+	if err = json.Unmarshal(raw, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func reportPaths() []string {
+	paths := make([]string, 0)
+	for _, path := range strings.Split(os.Getenv(ReportEnv), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,85 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func mockReport() *Report {
+	return &Report{
+		Backend:      "*conformance.memStorage",
+		SuiteVersion: "(devel)",
+		Started:      time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Duration:     2 * time.Second,
+		Results: []Result{
+			{Name: "Test_Conformance/ActivityPub_tests/Load_Root_item", Status: StatusPass, Duration: time.Millisecond},
+			{Name: "Test_Conformance/Key_tests/load_Root_key", Status: StatusFail, Duration: time.Second},
+			{Name: "Test_Conformance/Password_tests", Status: StatusSkip},
+		},
+		Limits: map[string]int{limitContentSize: 1 << 20},
+	}
+}
+
+func TestReport_SaveLoad(t *testing.T) {
+	want := mockReport()
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := want.Save(path); err != nil {
+		t.Fatalf("unable to save report: %s", err)
+	}
+	got, err := LoadReport(path)
+	if err != nil {
+		t.Fatalf("unable to load report: %s", err)
+	}
+	if !cmp.Equal(want, got, cmpopts.IgnoreUnexported(Report{})) {
+		t.Errorf("loaded report is different %s", cmp.Diff(want, got, cmpopts.IgnoreUnexported(Report{})))
+	}
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	r := mockReport()
+	buf := bytes.Buffer{}
+	if err := r.WriteJUnit(&buf); err != nil {
+		t.Fatalf("unable to write JUnit report: %s", err)
+	}
+	got := junitTestSuites{}
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unable to parse JUnit report: %s", err)
+	}
+	if len(got.Suites) != 1 {
+		t.Fatalf("invalid number of test suites %d, expected 1", len(got.Suites))
+	}
+	suite := got.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 {
+		t.Errorf("invalid test counts tests=%d failures=%d skipped=%d", suite.Tests, suite.Failures, suite.Skipped)
+	}
+	if suite.Cases[0].ClassName != "Test_Conformance/ActivityPub_tests" || suite.Cases[0].Name != "Load_Root_item" {
+		t.Errorf("invalid test case names %s %s", suite.Cases[0].ClassName, suite.Cases[0].Name)
+	}
+	if suite.Cases[1].Failure == nil {
+		t.Errorf("expected failure for test case %s", suite.Cases[1].Name)
+	}
+	if suite.Cases[2].Skipped == nil {
+		t.Errorf("expected skipped for test case %s", suite.Cases[2].Name)
+	}
+}
+
+func TestReport_Merge(t *testing.T) {
+	r := mockReport()
+	other := mockReport()
+	other.Limits = map[string]int{limitContentSize: 1 << 10, limitAttachments: 256}
+	r.Merge(other)
+
+	if len(r.Results) != 6 {
+		t.Errorf("invalid number of merged results %d, expected 6", len(r.Results))
+	}
+	want := map[string]int{limitContentSize: 1 << 20, limitAttachments: 256}
+	if !cmp.Equal(want, r.Limits) {
+		t.Errorf("invalid merged limits %s", cmp.Diff(want, r.Limits))
+	}
+}
@@ -0,0 +1,384 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Level is the requirement level of a check, in the sense of RFC 2119.
+type Level uint8
+
+const (
+	LevelMay Level = iota + 1
+	LevelShould
+	LevelMust
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelMust:
+		return "MUST"
+	case LevelShould:
+		return "SHOULD"
+	case LevelMay:
+		return "MAY"
+	}
+	return "UNKNOWN"
+}
+
+// Requirement is one of the behaviours the suite checks storage backends for.
+// The ID is stable between versions of the suite, so it can be used to reference it from reports and documentation.
+type Requirement struct {
+	ID          string
+	Level       Level
+	Group       TestType
+	Description string
+}
+
+var (
+	catalog  = make(map[string]Requirement)
+	catalogM sync.Mutex
+)
+
+func requirement(id string, lvl Level, group TestType, desc string) Requirement {
+	catalogM.Lock()
+	defer catalogM.Unlock()
+
+	if _, ok := catalog[id]; ok {
+		panic(fmt.Sprintf("duplicate requirement ID %s", id))
+	}
+	req := Requirement{ID: id, Level: lvl, Group: group, Description: desc}
+	catalog[id] = req
+	return req
+}
+
+var (
+	reqAPLoad = requirement("AP-LOAD", LevelMust, TestActivityPub,
+		"Loading a saved item returns it unchanged.")
+	reqAPSave = requirement("AP-SAVE", LevelMust, TestActivityPub,
+		"Save returns the item it received, and loading it afterwards returns an equal item.")
+	reqAPRoundTrip = requirement("AP-ROUND-TRIP", LevelMust, TestActivityPub,
+		"Saving and loading an item of any of the types in vocab.Types, with all its properties set, returns an equal item, "+
+			"of the same concrete Go type.")
+	reqAPNaturalLanguage = requirement("AP-NATURAL-LANGUAGE", LevelMust, TestActivityPub,
+		"Saving and loading items whose names, summaries and content have values in multiple languages, including "+
+			"right to left and CJK scripts, combining characters and values without a language, returns them unchanged.")
+	reqAPNaturalLanguageFilter = requirement("AP-NATURAL-LANGUAGE-FILTER", LevelMust, TestActivityPub,
+		"Loading a collection with filters on the names of its items in other languages than the default one, "+
+			"returns the same items as applying the filters in memory.")
+	reqAPSizeLimits = requirement("AP-SIZE-LIMITS", LevelMust, TestActivityPub,
+		"Saving items with up to 64KB of content, up to 64 attachments, or collections with IRIs of up to 512 "+
+			"characters stores them unchanged.")
+	reqAPSizeLimitsLarge = requirement("AP-SIZE-LIMITS-LARGE", LevelShould, TestActivityPub,
+		"Saving items with larger content, more attachments or longer IRIs either stores them unchanged, or returns "+
+			"an error, without panicking and without storing a different item.")
+	reqAPIRIEquivalent = requirement("AP-IRI-EQUIVALENT", LevelShould, TestActivityPub,
+		"IRIs which differ only in the case of their host, the default port of their scheme, a trailing slash, or the "+
+			"percent-encoding of their path, load the same item, whose ID is the IRI it was saved with.")
+	reqAPIRIDistinct = requirement("AP-IRI-DISTINCT", LevelMust, TestActivityPub,
+		"IRIs which differ in their query strings, fragments, schemes, non default ports, the case of their paths, "+
+			"or their hosts, including IPv6 ones, identify different items.")
+	reqAPMultiHostLoad = requirement("AP-MULTI-HOST-LOAD", LevelMust, TestActivityPub,
+		"Items from remote hosts, like the cached actors of other instances and their activities, are saved and "+
+			"loaded unchanged alongside the local ones.")
+	reqAPMultiHostMembership = requirement("AP-MULTI-HOST-MEMBERSHIP", LevelMust, TestActivityPub,
+		"Collections of local actors can contain remote items, and collections of remote actors can contain local "+
+			"items, or items from other remote hosts.")
+	reqAPMultiHostFilter = requirement("AP-MULTI-HOST-FILTER", LevelMust, TestActivityPub,
+		"Loading a collection containing activities from multiple hosts with filters on their attributedTo, their "+
+			"actors, or their hosts, returns the same items as applying the filters in memory.")
+	reqAPSaveCollections = requirement("AP-SAVE-COLLECTIONS", LevelMust, TestActivityPub,
+		"Saving an Object or Actor creates the collections from vocab.OfObject and vocab.OfActor that have IRIs set, "+
+			"as empty collections, whatever their IRI paths are.")
+	reqAPSaveCollectionsOwner = requirement("AP-SAVE-COLLECTIONS-OWNER", LevelShould, TestActivityPub,
+		"The collections created when saving an Object or Actor are attributed to it.")
+	reqAPUpdate = requirement("AP-UPDATE", LevelMust, TestActivityPub,
+		"Saving a modified version of an existing item replaces it: loading it afterwards returns exactly the new version.")
+	reqAPUpdateCollections = requirement("AP-UPDATE-COLLECTIONS", LevelShould, TestActivityPub,
+		"Saving an existing item keeps the items of its collections, and doesn't create the collections whose IRIs changed.")
+	reqAPCollectionNotFound = requirement("AP-COLLECTION-NOT-FOUND", LevelMust, TestActivityPub,
+		"AddTo and RemoveFrom return a not found error for collections that don't exist.")
+	reqAPCollectionSave = requirement("AP-COLLECTION-SAVE", LevelMust, TestActivityPub,
+		"Saving a collection and loading it afterwards returns an equal collection.")
+	reqAPCollectionAdd = requirement("AP-COLLECTION-ADD", LevelMust, TestActivityPub,
+		"AddTo adds the items to the collection, and updates its total items count.")
+	reqAPCollectionAddIdempotent = requirement("AP-COLLECTION-ADD-IDEMPOTENT", LevelMust, TestActivityPub,
+		"Adding an item which is already in a collection, as a full object or by its IRI, succeeds without duplicating it "+
+			"or changing the total items count.")
+	reqAPCollectionAddIRI = requirement("AP-COLLECTION-ADD-IRI", LevelMust, TestActivityPub,
+		"AddTo accepts items as IRIs: loading the collection returns them as IRIs, or as the saved items with those IRIs.")
+	reqAPCollectionRemoveIdempotent = requirement("AP-COLLECTION-REMOVE-IDEMPOTENT", LevelMust, TestActivityPub,
+		"Removing items which are not in a collection succeeds, without changing its items or its total items count.")
+	reqAPCollectionRemoveIRI = requirement("AP-COLLECTION-REMOVE-IRI", LevelMust, TestActivityPub,
+		"RemoveFrom removes items by their IRI, also when they were added to the collection as full objects.")
+	reqAPCollectionNotCollection = requirement("AP-COLLECTION-NOT-COLLECTION", LevelMust, TestActivityPub,
+		"AddTo and RemoveFrom return a bad request error for IRIs of items which are not collections, and don't modify them.")
+	reqAPCollectionOrder = requirement("AP-COLLECTION-ORDER", LevelMust, TestActivityPub,
+		"Loading an OrderedCollection returns its items in the reverse of the order they were added in, the most recent first, "+
+			"also when loading it with filters or pagination. The items of unordered Collections can be returned in any order.")
+	reqAPCollectionFilter = requirement("AP-COLLECTION-FILTER", LevelMust, TestActivityPub,
+		"Loading a collection with filters returns only the matching items, and the total items count of the full collection.")
+	reqAPCollectionFilterMatrix = requirement("AP-COLLECTION-FILTER-MATRIX", LevelMust, TestActivityPub,
+		"Loading a collection with combinations of Any, All and Not filters on types, names, content, authors, "+
+			"publishing dates and IDs, with or without pagination, returns the same items as applying the filters in memory.")
+	reqAPDereference = requirement("AP-DEREFERENCE", LevelMust, TestActivityPub,
+		"Loading a collection with filters on the properties of the actors, objects or targets of its activities "+
+			"dereferences them one level deep, and returns the activities whose dereferenced properties match.")
+	reqAPCollectionPaginate = requirement("AP-COLLECTION-PAGINATE", LevelMust, TestActivityPub,
+		"Loading a collection with a maximum count returns pages of that size, and the next page IRI for traversing it.")
+	reqAPCollectionCursor = requirement("AP-COLLECTION-CURSOR", LevelMust, TestActivityPub,
+		"Loading a collection with after and before cursors, alone or combined with type filters and pagination, "+
+			"returns the same items as applying them in memory, and walking its pages forwards and backwards visits every item once.")
+	reqAPCollectionPaginateConcurrent = requirement("AP-COLLECTION-PAGINATE-CONCURRENT", LevelShould, TestActivityPub,
+		"Walking the pages of a collection while items get added to it and removed from it concurrently visits every "+
+			"item that was in the collection before the walk started exactly once, and none of the updates get lost.")
+	reqAPCollectionRemove = requirement("AP-COLLECTION-REMOVE", LevelMust, TestActivityPub,
+		"RemoveFrom removes the items from the collection, and updates its total items count.")
+	reqAPHiddenCreate = requirement("AP-HIDDEN-CREATE", LevelMust, TestActivityPub,
+		"AddTo creates the hidden \"blocked\" and \"ignored\" collections of an actor when they don't exist.")
+	reqAPHiddenFilter = requirement("AP-HIDDEN-FILTER", LevelMust, TestActivityPub,
+		"Loading the hidden collections of an actor with filters returns only the matching items.")
+	reqAPHiddenNotExposed = requirement("AP-HIDDEN-NOT-EXPOSED", LevelMust, TestActivityPub,
+		"The hidden collections don't appear as properties of the actor after reloading it.")
+	reqAPDelete = requirement("AP-DELETE", LevelMust, TestActivityPub,
+		"Loading a deleted item returns a nil item, or a not found error, or a Tombstone for backends which declare the tombstones capability.")
+	reqAPDeleteCollections = requirement("AP-DELETE-COLLECTIONS", LevelShould, TestActivityPub,
+		"Deleting an item deletes its own collections, including the hidden ones of actors.")
+	reqAPDeleteMembership = requirement("AP-DELETE-MEMBERSHIP", LevelShould, TestActivityPub,
+		"Deleting an item removes it from the collections which contain it, unless the backend replaces deleted items with Tombstones.")
+	reqAPDeleteCredentials = requirement("AP-DELETE-CREDENTIALS", LevelShould, TestActivityPub,
+		"Deleting an actor deletes its private key, password and metadata.")
+	reqAPDeleteTombstone = requirement("AP-DELETE-TOMBSTONE", LevelMust, TestActivityPub,
+		"Backends which declare the tombstones capability replace deleted items with Tombstones, which keep their IDs "+
+			"and former types, and stay in the collections which contained them.")
+
+	reqKeyLoad = requirement("KEY-LOAD", LevelMust, TestKey,
+		"A private key saved for an actor loads unchanged, and the public key of the saved actor matches it.")
+	reqKeyTypes = requirement("KEY-TYPES", LevelShould, TestKey,
+		"ECDSA (P-224, P-256, P-384, P-521), ED25519 and RSA private keys can be saved and loaded.")
+
+	reqPasswordCheck = requirement("PW-CHECK", LevelMust, TestPassword,
+		"A password set for an actor passes the password check.")
+
+	reqMetadataRoundTrip = requirement("META-ROUNDTRIP", LevelMust, TestMetadata,
+		"Metadata saved for an IRI loads unchanged.")
+
+	reqOAuthClient = requirement("OAUTH-CLIENT", LevelMust, TestOAuth,
+		"OAuth2 clients can be saved, loaded, updated and removed.")
+	reqOAuthClientList = requirement("OAUTH-CLIENT-LIST", LevelShould, TestOAuth,
+		"Listing OAuth2 clients returns all the saved clients.")
+	reqOAuthAuthorize = requirement("OAUTH-AUTHORIZE", LevelMust, TestOAuth,
+		"OAuth2 authorize data can be saved, loaded and removed.")
+	reqOAuthAccess = requirement("OAUTH-ACCESS", LevelMust, TestOAuth,
+		"OAuth2 access data can be saved, loaded and removed.")
+	reqOAuthRefresh = requirement("OAUTH-REFRESH", LevelMust, TestOAuth,
+		"OAuth2 access data can be loaded by its refresh token, and the refresh token can be removed.")
+)
+
+// Requirements returns the catalog of requirements checked by the suite, sorted by ID.
+func Requirements() []Requirement {
+	catalogM.Lock()
+	defer catalogM.Unlock()
+
+	result := make([]Requirement, 0, len(catalog))
+	for _, req := range catalog {
+		result = append(result, req)
+	}
+	slices.SortFunc(result, func(a, b Requirement) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return result
+}
+
+// RequirementByID returns the requirement with the "id" ID from the catalog.
+func RequirementByID(id string) (Requirement, bool) {
+	catalogM.Lock()
+	defer catalogM.Unlock()
+
+	req, ok := catalog[id]
+	return req, ok
+}
+
+// WriteRequirements writes the catalog of requirements as a Markdown table.
+func WriteRequirements(w io.Writer) error {
+	if _, err := io.WriteString(w, "| ID | Level | Description |\n|----|-------|-------------|\n"); err != nil {
+		return err
+	}
+	for _, req := range Requirements() {
+		if _, err := fmt.Fprintf(w, "| %s | %s | %s |\n", req.ID, req.Level, req.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModeEnv is the environment variable which controls how failures of SHOULD requirements are treated.
+// When set to "lenient" they are only reported as warnings, like with the WithLenient option, otherwise
+// they fail the tests.
+const ModeEnv = "CONFORMANCE_MODE"
+
+// check wraps the [testing.T] of a test verifying a requirement.
+// When the requirement is not mandatory, failures get logged as warnings instead of failing the test.
+// MUST requirements are always mandatory, SHOULD requirements only in strict mode, and MAY requirements never.
+type check struct {
+	*testing.T
+
+	req    Requirement
+	strict bool
+	warned bool
+	// abandoned is set when the check exceeded the deadline of its test group, and its test finished
+	// without waiting for it.
+	abandoned atomic.Bool
+}
+
+// stopIfAbandoned stops the goroutine executing the check, if the check was abandoned, as its test
+// already finished, and it can't report anything anymore.
+func (c *check) stopIfAbandoned() {
+	if c.abandoned.Load() {
+		runtime.Goexit()
+	}
+}
+
+func (c *check) mandatory() bool {
+	return c.req.Level == LevelMust || (c.strict && c.req.Level == LevelShould)
+}
+
+func (c *check) warn(format string, args ...any) {
+	c.T.Helper()
+	c.stopIfAbandoned()
+
+	c.warned = true
+	c.T.Logf("WARNING %s %s: %s", c.req.Level, c.req.ID, fmt.Sprintf(format, args...))
+}
+
+func (c *check) Errorf(format string, args ...any) {
+	c.T.Helper()
+	c.stopIfAbandoned()
+
+	if c.mandatory() {
+		c.T.Errorf(format, args...)
+		return
+	}
+	c.warn(format, args...)
+}
+
+// Fatalf stops the execution of the test. For requirements that are not mandatory, the test gets marked as skipped.
+func (c *check) Fatalf(format string, args ...any) {
+	c.T.Helper()
+	c.stopIfAbandoned()
+
+	if c.mandatory() {
+		c.T.Fatalf(format, args...)
+		return
+	}
+	c.warn(format, args...)
+	c.T.SkipNow()
+}
+
+func (c *check) Error(args ...any) {
+	c.T.Helper()
+
+	c.Errorf("%s", sprintln(args...))
+}
+
+func (c *check) Fail() {
+	c.T.Helper()
+	c.stopIfAbandoned()
+
+	if c.mandatory() {
+		c.T.Fail()
+		return
+	}
+	c.warn("the check failed")
+}
+
+func (c *check) Fatal(args ...any) {
+	c.T.Helper()
+
+	c.Fatalf("%s", sprintln(args...))
+}
+
+func (c *check) FailNow() {
+	c.T.Helper()
+	c.stopIfAbandoned()
+
+	if c.mandatory() {
+		c.T.FailNow()
+		return
+	}
+	c.warn("the check failed")
+	c.T.SkipNow()
+}
+
+func (c *check) Logf(format string, args ...any) {
+	c.T.Helper()
+	c.stopIfAbandoned()
+
+	c.T.Logf(format, args...)
+}
+
+func (c *check) Skipf(format string, args ...any) {
+	c.T.Helper()
+	c.stopIfAbandoned()
+
+	c.T.Skipf(format, args...)
+}
+
+// sprintln formats the arguments the way [testing.T.Error] and [testing.T.Fatal] do.
+func sprintln(args ...any) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
+
+// require executes fn as the "name" subtest of t, as a check of the "req" requirement.
+func (r *runner) require(t *testing.T, name string, req Requirement, fn func(t *check)) bool {
+	t.Helper()
+
+	return t.Run(name, func(t *testing.T) {
+		c := &check{T: t, req: req, strict: r.strict}
+		if r.report != nil {
+			started := time.Now()
+			t.Cleanup(func() {
+				r.report.recordCheck(c, started)
+			})
+		}
+		if !r.conf.enabled(req.Level) {
+			t.Skipf("%s requirements are not enabled", req.Level)
+		}
+		r.checkDeadline(t)
+		r.untilDeadline(c, fn)
+	})
+}
+
+// untilDeadline executes fn, and fails the check if the deadline of the test group passes before fn returns.
+// In that case the check gets abandoned: fn keeps running in the background, but nothing it reports after
+// that gets recorded, so a backend call that never returns doesn't block the rest of the suite.
+func (r *runner) untilDeadline(c *check, fn func(t *check)) {
+	c.T.Helper()
+
+	if r.deadline.IsZero() {
+		fn(c)
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(c)
+	}()
+
+	timer := time.NewTimer(time.Until(r.deadline))
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		defer c.abandoned.Store(true)
+		c.Fatalf("the timeout of %s for the test group was exceeded", r.conf.timeout)
+	}
+}
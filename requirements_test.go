@@ -0,0 +1,114 @@
+package conformance
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequirements(t *testing.T) {
+	reqs := Requirements()
+	if len(reqs) == 0 {
+		t.Fatalf("empty requirements catalog")
+	}
+	for i, req := range reqs {
+		if req.ID == "" {
+			t.Errorf("requirement %d has empty ID", i)
+		}
+		if req.Level < LevelMay || req.Level > LevelMust {
+			t.Errorf("requirement %s has invalid level %d", req.ID, req.Level)
+		}
+		if req.Description == "" {
+			t.Errorf("requirement %s has empty description", req.ID)
+		}
+		if i > 0 && reqs[i-1].ID >= req.ID {
+			t.Errorf("requirements are not sorted by ID: %s before %s", reqs[i-1].ID, req.ID)
+		}
+		if got, ok := RequirementByID(req.ID); !ok || got != req {
+			t.Errorf("RequirementByID(%s) = %v, %t", req.ID, got, ok)
+		}
+	}
+}
+
+func TestWriteRequirements(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := WriteRequirements(&buf); err != nil {
+		t.Fatalf("unable to write requirements: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if want := len(Requirements()) + 2; len(lines) != want {
+		t.Errorf("invalid number of lines %d, expected %d", len(lines), want)
+	}
+}
+
+func Test_checkMandatory(t *testing.T) {
+	tests := []struct {
+		level  Level
+		strict bool
+		want   bool
+	}{
+		{LevelMust, true, true},
+		{LevelMust, false, true},
+		{LevelShould, true, true},
+		{LevelShould, false, false},
+		{LevelMay, true, false},
+		{LevelMay, false, false},
+	}
+	for _, tt := range tests {
+		c := check{req: Requirement{Level: tt.level}, strict: tt.strict}
+		if got := c.mandatory(); got != tt.want {
+			t.Errorf("mandatory() for %s, strict %t = %t, expected %t", tt.level, tt.strict, got, tt.want)
+		}
+	}
+}
+
+func Test_checkLenientFailures(t *testing.T) {
+	failures := map[string]func(c *check){
+		"Error":   func(c *check) { c.Error("invalid", "item") },
+		"Errorf":  func(c *check) { c.Errorf("invalid %s", "item") },
+		"Fail":    func(c *check) { c.Fail() },
+		"Fatal":   func(c *check) { c.Fatal("invalid", "item") },
+		"Fatalf":  func(c *check) { c.Fatalf("invalid %s", "item") },
+		"FailNow": func(c *check) { c.FailNow() },
+	}
+	for name, fail := range failures {
+		t.Run(name, func(t *testing.T) {
+			c := &check{T: t, req: Requirement{ID: "TEST", Level: LevelShould}}
+			t.Cleanup(func() {
+				if t.Failed() {
+					t.Errorf("%s of a lenient SHOULD check failed the test", name)
+				}
+				if !c.warned {
+					t.Errorf("%s of a lenient SHOULD check didn't log a warning", name)
+				}
+			})
+			fail(c)
+		})
+	}
+}
+
+func Test_checkTimeout(t *testing.T) {
+	r := newRunner(nil, WithTimeout(10*time.Millisecond), WithLenient()).forGroup(TestActivityPub)
+	req := Requirement{ID: "TEST", Level: LevelShould}
+
+	started := make(chan *check, 1)
+	unblock := make(chan struct{})
+	resumed := make(chan struct{})
+	r.require(t, "hanging check", req, func(t *check) {
+		defer close(resumed)
+		started <- t
+		<-unblock
+		t.Errorf("reported after the check was abandoned")
+	})
+	c := <-started
+	if !c.warned {
+		t.Errorf("exceeding the timeout of a lenient SHOULD check didn't log a warning")
+	}
+	if !c.abandoned.Load() {
+		t.Errorf("the check exceeding the timeout wasn't abandoned")
+	}
+
+	close(unblock)
+	<-resumed
+}
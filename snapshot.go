@@ -0,0 +1,308 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/filters"
+	"github.com/go-ap/storage-conformance-suite/gen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Snapshot contains the results a reference storage backend returned for a seeded workload.
+// Replaying the same workload against another backend shows where the two behave differently.
+type Snapshot struct {
+	Backend      string      `json:"backend"`
+	SuiteVersion string      `json:"suiteVersion"`
+	Seed         uint64      `json:"seed"`
+	Objects      int         `json:"objects"`
+	PageSizes    []int       `json:"pageSizes"`
+	Operations   []Operation `json:"operations"`
+}
+
+// Operation is the result of one of the storage calls of the snapshot workload.
+type Operation struct {
+	Name   string          `json:"name"`
+	IRI    vocab.IRI       `json:"iri"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Save writes the snapshot as JSON to "path".
+func (s *Snapshot) Save(path string) error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o644)
+}
+
+// LoadSnapshot reads a snapshot previously written by RecordSnapshot.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Snapshot)
+	if err = json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.IsNotFound(err):
+		return "not found"
+	case errors.IsBadRequest(err):
+		return "bad request"
+	default:
+		return "error"
+	}
+}
+
+// workload executes the storage calls of the snapshot, and keeps their results.
+type workload struct {
+	storage ActivityPubStorage
+	ops     []Operation
+}
+
+func (w *workload) record(name string, iri vocab.IRI, it vocab.Item, err error) {
+	op := Operation{Name: name, IRI: iri, Error: errorClass(err)}
+	if !vocab.IsNil(it) {
+		if raw, err := vocab.MarshalJSON(it); err == nil {
+			op.Result = raw
+		} else {
+			op.Error = fmt.Sprintf("unable to marshal result: %s", err)
+		}
+	}
+	w.ops = append(w.ops, op)
+}
+
+func (w *workload) save(name string, it vocab.Item) {
+	saved, err := w.storage.Save(it)
+	w.record(name, it.GetLink(), saved, err)
+}
+
+func (w *workload) load(name string, iri vocab.IRI, checks ...filters.Check) vocab.Item {
+	it, err := w.storage.Load(iri, checks...)
+	w.record(name, iri, it, err)
+	return it
+}
+
+// traverse loads the pages of the collection, following their next page IRIs.
+func (w *workload) traverse(colIRI vocab.IRI, size, total int) {
+	checks := filters.Checks{filters.WithMaxCount(size)}
+	for page := range total + 1 {
+		it := w.load(fmt.Sprintf("traverse collection with pagination %d, page %d", size, page), colIRI, checks...)
+		var nextIRI vocab.IRI
+		_ = vocab.OnCollectionIntf(it, func(col vocab.CollectionInterface) error {
+			if next := filters.NextPageFromCollection(col); !vocab.IsNil(next) {
+				nextIRI = next.GetLink()
+			}
+			return nil
+		})
+		if nextIRI == "" || colIRI.Equal(nextIRI) {
+			return
+		}
+		var err error
+		if checks, err = filters.FromIRI(nextIRI); err != nil {
+			return
+		}
+	}
+}
+
+// runWorkload executes the snapshot workload for the seed: it saves the random objects and a collection
+// containing them, loads all of them, loads the collection with each type filter, and traverses it
+// with each of the page sizes.
+func runWorkload(storage ActivityPubStorage, seed uint64, count int, pageSizes []int) []Operation {
+	gen.Seed(seed)
+	data := newDataset(count, gen.RootID)
+	colIRI := data.col.GetLink()
+
+	w := &workload{storage: storage}
+	w.save("save root", gen.Root)
+	for _, ob := range data.objects {
+		w.save(fmt.Sprintf("save %s", ob.GetLink()), ob)
+	}
+	w.save("save collection", data.col)
+	w.record("add items to collection", colIRI, nil, storage.AddTo(colIRI, data.objects...))
+
+	for _, ob := range data.objects {
+		w.load(fmt.Sprintf("load %s", ob.GetLink()), ob.GetLink())
+	}
+	w.load("load collection", colIRI)
+	for _, typ := range vocab.Types {
+		w.load(fmt.Sprintf("load collection with type %s", typ), colIRI, filters.HasType(typ))
+	}
+	for _, size := range pageSizes {
+		w.traverse(colIRI, size, count)
+	}
+	return w.ops
+}
+
+// RecordSnapshot executes the snapshot workload against the reference storage,
+// and writes its results to a snapshot file at "path".
+// The size of the dataset, the seed and the page sizes can be changed with the corresponding options.
+func RecordSnapshot(t *testing.T, storage ActivityPubStorage, path string, opts ...Option) {
+	t.Helper()
+
+	maybeClose := maybeOpen(t, storage)
+	defer maybeClose()
+
+	conf := newConfig(opts...)
+	s := Snapshot{
+		Backend:      fmt.Sprintf("%T", storage),
+		SuiteVersion: suiteVersion(),
+		Seed:         conf.seed,
+		Objects:      conf.objects,
+		PageSizes:    conf.queryPageSizes(),
+	}
+	s.Operations = runWorkload(storage, s.Seed, s.Objects, s.PageSizes)
+	if err := s.Save(path); err != nil {
+		t.Fatalf("unable to write snapshot %s: %s", path, err)
+	}
+}
+
+// CompareSnapshot executes the workload of the snapshot at "path" against storage,
+// and fails the test for every operation whose result differs semantically from the recorded one.
+func CompareSnapshot(t *testing.T, storage ActivityPubStorage, path string) {
+	t.Helper()
+
+	want, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("unable to load snapshot %s: %s", path, err)
+	}
+
+	maybeClose := maybeOpen(t, storage)
+	defer maybeClose()
+
+	got := runWorkload(storage, want.Seed, want.Objects, want.PageSizes)
+
+	different := 0
+	for i := range max(len(want.Operations), len(got)) {
+		var wantOp, gotOp Operation
+		if i < len(want.Operations) {
+			wantOp = want.Operations[i]
+		}
+		if i < len(got) {
+			gotOp = got[i]
+		}
+		if diffs := diffOperations(wantOp, gotOp); len(diffs) > 0 {
+			different++
+			t.Errorf("%s: %s", wantOp.Name, strings.Join(diffs, "; "))
+		}
+	}
+	if different > 0 {
+		t.Logf("%d of %d operations differ from the %s snapshot of %s", different, len(want.Operations), path, want.Backend)
+	}
+}
+
+func diffOperations(want, got Operation) []string {
+	if want.Name != got.Name {
+		return []string{fmt.Sprintf("expected operation %q, got %q", want.Name, got.Name)}
+	}
+	if want.Error != got.Error {
+		return []string{fmt.Sprintf("expected error %q, got %q", want.Error, got.Error)}
+	}
+	var wantIt, gotIt vocab.Item
+	if len(want.Result) > 0 {
+		wantIt, _ = vocab.UnmarshalJSON(want.Result)
+	}
+	if len(got.Result) > 0 {
+		gotIt, _ = vocab.UnmarshalJSON(got.Result)
+	}
+	return diffItems(wantIt, gotIt)
+}
+
+func totalItems(it vocab.Item) (uint, bool) {
+	switch col := it.(type) {
+	case *vocab.OrderedCollection:
+		return col.TotalItems, true
+	case *vocab.OrderedCollectionPage:
+		return col.TotalItems, true
+	case *vocab.Collection:
+		return col.TotalItems, true
+	case *vocab.CollectionPage:
+		return col.TotalItems, true
+	}
+	return 0, false
+}
+
+func collectionItems(it vocab.Item) vocab.ItemCollection {
+	var items vocab.ItemCollection
+	_ = vocab.OnCollectionIntf(it, func(col vocab.CollectionInterface) error {
+		items = col.Collection()
+		return nil
+	})
+	return items
+}
+
+func itemIDs(items vocab.ItemCollection) []string {
+	ids := make([]string, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.GetLink().String())
+	}
+	return ids
+}
+
+// diffItems returns the semantic differences between the two items: for collections, it reports separately
+// the differences in total items, in ordering, and in which of their items are dereferenced.
+func diffItems(want, got vocab.Item) []string {
+	switch {
+	case vocab.IsNil(want) && vocab.IsNil(got):
+		return nil
+	case vocab.IsNil(want):
+		return []string{fmt.Sprintf("expected no result, got %s", got.GetLink())}
+	case vocab.IsNil(got):
+		return []string{fmt.Sprintf("expected %s, got no result", want.GetLink())}
+	}
+
+	wantTotal, wantIsCol := totalItems(want)
+	gotTotal, gotIsCol := totalItems(got)
+	if !wantIsCol || !gotIsCol {
+		if !cmp.Equal(want, got, EquateItems) {
+			return []string{cmp.Diff(want, got, EquateItems)}
+		}
+		return nil
+	}
+
+	diffs := make([]string, 0)
+	if !want.GetLink().Equal(got.GetLink()) {
+		diffs = append(diffs, fmt.Sprintf("expected collection %s, got %s", want.GetLink(), got.GetLink()))
+	}
+	if wantTotal != gotTotal {
+		diffs = append(diffs, fmt.Sprintf("expected %d total items, got %d", wantTotal, gotTotal))
+	}
+
+	wantItems, gotItems := collectionItems(want), collectionItems(got)
+	wantIDs, gotIDs := itemIDs(wantItems), itemIDs(gotItems)
+	if !slices.Equal(wantIDs, gotIDs) {
+		sortedWant, sortedGot := slices.Sorted(slices.Values(wantIDs)), slices.Sorted(slices.Values(gotIDs))
+		if slices.Equal(sortedWant, sortedGot) {
+			diffs = append(diffs, fmt.Sprintf("items ordering differs, expected %v, got %v", wantIDs, gotIDs))
+		} else {
+			diffs = append(diffs, fmt.Sprintf("items differ, expected %v, got %v", wantIDs, gotIDs))
+		}
+	}
+	for _, w := range wantItems {
+		for _, g := range gotItems {
+			if !w.GetLink().Equal(g.GetLink()) {
+				continue
+			}
+			if vocab.IsIRI(w) != vocab.IsIRI(g) {
+				diffs = append(diffs, fmt.Sprintf("item %s is dereferenced differently, expected IRI %t, got IRI %t",
+					w.GetLink(), vocab.IsIRI(w), vocab.IsIRI(g)))
+			}
+		}
+	}
+	return diffs
+}
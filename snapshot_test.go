@@ -0,0 +1,84 @@
+package conformance
+
+import (
+	"strings"
+	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+)
+
+func orderedCollection(total uint, items ...vocab.Item) *vocab.OrderedCollection {
+	return &vocab.OrderedCollection{
+		ID:           "https://example.com/inbox",
+		Type:         vocab.OrderedCollectionType,
+		TotalItems:   total,
+		OrderedItems: items,
+	}
+}
+
+func Test_diffItems(t *testing.T) {
+	first := &vocab.Object{ID: "https://example.com/1", Type: vocab.NoteType}
+	second := &vocab.Object{ID: "https://example.com/2", Type: vocab.NoteType}
+
+	tests := []struct {
+		name string
+		want vocab.Item
+		got  vocab.Item
+		diff string
+	}{
+		{
+			name: "both nil",
+		},
+		{
+			name: "missing result",
+			want: first,
+			diff: "got no result",
+		},
+		{
+			name: "same collection",
+			want: orderedCollection(2, first, second),
+			got:  orderedCollection(2, first, second),
+		},
+		{
+			name: "total items",
+			want: orderedCollection(2, first, second),
+			got:  orderedCollection(3, first, second),
+			diff: "expected 2 total items, got 3",
+		},
+		{
+			name: "ordering",
+			want: orderedCollection(2, first, second),
+			got:  orderedCollection(2, second, first),
+			diff: "items ordering differs",
+		},
+		{
+			name: "missing items",
+			want: orderedCollection(2, first, second),
+			got:  orderedCollection(2, first),
+			diff: "items differ",
+		},
+		{
+			name: "dereferencing",
+			want: orderedCollection(2, first, second),
+			got:  orderedCollection(2, first, second.GetLink()),
+			diff: "https://example.com/2 is dereferenced differently",
+		},
+		{
+			name: "different objects",
+			want: first,
+			got:  second,
+			diff: "https://example.com/2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := strings.Join(diffItems(tt.want, tt.got), "; ")
+			if tt.diff == "" && diffs != "" {
+				t.Errorf("diffItems() returned unexpected differences: %s", diffs)
+			}
+			if !strings.Contains(diffs, tt.diff) {
+				t.Errorf("diffItems() = %q, expected it to contain %q", diffs, tt.diff)
+			}
+		})
+	}
+}
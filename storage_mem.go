@@ -9,8 +9,10 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"net/url"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -37,6 +39,11 @@ var errNilStorage = errf("nil storage")
 
 type memStorage struct {
 	*sync.Map
+	// colMu serializes the updates of collections, which load the collection, modify a copy of it,
+	// and store it back, so the concurrent AddTo and RemoveFrom calls don't overwrite each other's items.
+	colMu sync.Mutex
+	// tombstones makes Delete replace the items with Tombstones, instead of removing them.
+	tombstones bool
 }
 
 func asBytes(s any) []byte {
@@ -59,8 +66,27 @@ var (
 	allCollectionTypes = append(collectionTypes, orderedCollectionTypes...)
 )
 
+// itemKey returns the key under which the item with the "i" IRI is stored, which is also the base of the keys
+// of its private key, password and metadata. It normalizes the IRIs which identify the same item: the host
+// is lowercased, the default port of the scheme is dropped, and the path gets its trailing slash removed and
+// its percent-encoding made canonical. The query and the fragment are left untouched, so IRIs which differ
+// only in them are keys of different items.
+func itemKey(i vocab.IRI) vocab.IRI {
+	u, err := url.Parse(string(i))
+	if err != nil || u.Host == "" {
+		return i
+	}
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return vocab.IRI(u.String())
+}
+
 func (ms *memStorage) Load(i vocab.IRI, f ...filters.Check) (vocab.Item, error) {
-	raw, ok := ms.Map.Load(i)
+	raw, ok := ms.Map.Load(itemKey(i))
 	if !ok {
 		return nil, errors.NotFoundf("unable to find %s", i)
 	}
@@ -69,29 +95,79 @@ func (ms *memStorage) Load(i vocab.IRI, f ...filters.Check) (vocab.Item, error)
 		return nil, errors.Newf("invalid item type in storage %T", raw)
 	}
 
-	if len(f) == 0 {
+	if len(f) == 0 || !allCollectionTypes.Match(ob.GetType()) {
 		return ob, nil
 	}
-	typ := ob.GetType()
-	switch {
-	case vocab.ActivityVocabularyTypes{vocab.OrderedCollectionType, vocab.OrderedCollectionPageType}.Match(typ):
-		clone, _ := ob.(*vocab.OrderedCollection)
-		obCopy := *clone
-		return filters.Checks(f).Run(&obCopy), nil
-	case vocab.ActivityVocabularyTypes{vocab.CollectionType, vocab.CollectionPageType}.Match(typ):
-		clone, _ := ob.(*vocab.Collection)
-		obCopy := *clone
-		return filters.Checks(f).Run(&obCopy), nil
-	default:
-		return ob, nil
+	// NOTE(marius): the filters get applied on a copy of the collection, so they don't modify its items
+	// while other goroutines are reading, or appending to them.
+	col, err := ms.loadCol(i)
+	if err != nil {
+		return nil, err
 	}
+	return ms.filter(col, f), nil
+}
+
+// loadIfIRI returns the item stored for "it" if it is an IRI, otherwise "it" itself.
+func (ms *memStorage) loadIfIRI(it vocab.Item) vocab.Item {
+	if !vocab.IsIRI(it) {
+		return it
+	}
+	if raw, ok := ms.Map.Load(itemKey(it.GetLink())); ok {
+		if ob, ok := raw.(vocab.Item); ok {
+			return ob
+		}
+	}
+	return it
+}
+
+// dereference returns a copy of the activity with its actor, object and target loaded from storage,
+// so the filters can check their properties. Other items are returned unchanged.
+func (ms *memStorage) dereference(it vocab.Item) (vocab.Item, bool) {
+	switch act := it.(type) {
+	case *vocab.Activity:
+		clone := *act
+		clone.Actor = ms.loadIfIRI(clone.Actor)
+		clone.Object = ms.loadIfIRI(clone.Object)
+		clone.Target = ms.loadIfIRI(clone.Target)
+		return &clone, true
+	case *vocab.IntransitiveActivity:
+		clone := *act
+		clone.Actor = ms.loadIfIRI(clone.Actor)
+		clone.Target = ms.loadIfIRI(clone.Target)
+		return &clone, true
+	}
+	return it, false
+}
+
+// filter applies the filters on the items of the collection, with their properties dereferenced one level deep.
+// The items in the result are the stored ones, so the dereferenced properties don't leak to the callers.
+func (ms *memStorage) filter(col vocab.CollectionInterface, f filters.Checks) vocab.Item {
+	originals := make(map[vocab.IRI]vocab.Item)
+	items := col.Collection()
+	for idx, it := range items {
+		if derefd, ok := ms.dereference(it); ok {
+			originals[it.GetLink()] = it
+			items[idx] = derefd
+		}
+	}
+	result := f.Run(col)
+	_ = vocab.OnCollectionIntf(result, func(c vocab.CollectionInterface) error {
+		filtered := c.Collection()
+		for idx, it := range filtered {
+			if orig, ok := originals[it.GetLink()]; ok {
+				filtered[idx] = orig
+			}
+		}
+		return nil
+	})
+	return result
 }
 
 func saveCollectionIfExists(r *memStorage, it, owner vocab.Item) vocab.Item {
 	if vocab.IsNil(it) {
 		return nil
 	}
-	r.Map.LoadOrStore(it.GetLink(), createNewCollection(it.GetLink(), owner))
+	r.Map.LoadOrStore(itemKey(it.GetLink()), createNewCollection(it.GetLink(), owner))
 	return it.GetLink()
 }
 
@@ -115,40 +191,104 @@ func createItemCollections(ms *memStorage, it vocab.Item) error {
 	}
 	if vocab.ActorTypes.Match(it.GetType()) {
 		_ = vocab.OnActor(it, func(p *vocab.Actor) error {
-			p.Inbox = saveCollectionIfExists(ms, p.Inbox, p)
-			p.Outbox = saveCollectionIfExists(ms, p.Outbox, p)
-			p.Followers = saveCollectionIfExists(ms, p.Followers, p)
-			p.Following = saveCollectionIfExists(ms, p.Following, p)
-			p.Liked = saveCollectionIfExists(ms, p.Liked, p)
-			// NOTE(marius): shadow creating hidden collections for Blocked and Ignored items
-			saveCollectionIfExists(ms, filters.BlockedType.Of(p), p)
-			saveCollectionIfExists(ms, filters.IgnoredType.Of(p), p)
+			setCollection(ms, &p.Inbox, p)
+			setCollection(ms, &p.Outbox, p)
+			setCollection(ms, &p.Followers, p)
+			setCollection(ms, &p.Following, p)
+			setCollection(ms, &p.Liked, p)
 			return nil
 		})
 	}
 	return vocab.OnObject(it, func(o *vocab.Object) error {
-		o.Replies = saveCollectionIfExists(ms, o.Replies, o)
-		o.Likes = saveCollectionIfExists(ms, o.Likes, o)
-		o.Shares = saveCollectionIfExists(ms, o.Shares, o)
+		setCollection(ms, &o.Replies, o)
+		setCollection(ms, &o.Likes, o)
+		setCollection(ms, &o.Shares, o)
 		return nil
 	})
 }
 
+// setCollection creates the collection and replaces the property with its IRI.
+// Properties that already are IRIs are left untouched, so saving the same item from multiple goroutines
+// doesn't write to it.
+func setCollection(ms *memStorage, prop *vocab.Item, owner vocab.Item) {
+	iri := saveCollectionIfExists(ms, *prop, owner)
+	if !vocab.IsIRI(*prop) {
+		*prop = iri
+	}
+}
+
 func (ms *memStorage) Save(it vocab.Item) (vocab.Item, error) {
-	if _, ok := ms.Map.Load(it.GetLink()); !ok {
+	key := itemKey(it.GetLink())
+	if _, ok := ms.Map.Load(key); !ok {
 		if err := createItemCollections(ms, it); err != nil {
 			return it, errors.Annotatef(err, "could not create object's collections")
 		}
 	}
-	ms.Map.Store(it.GetLink(), it)
+	ms.Map.Store(key, it)
 	return it, nil
 }
 
 func (ms *memStorage) Delete(it vocab.Item) error {
-	ms.Map.Delete(it.GetLink())
+	iri := it.GetLink()
+	old, err := ms.Load(iri)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	deleteItemCollections(ms, old)
+	for _, path := range []string{"privateKey", "__password", "__meta"} {
+		ms.Map.Delete(itemKey(iri).AddPath(path))
+	}
+	if ms.tombstones {
+		ms.Map.Store(itemKey(iri), tombstone(old))
+		return nil
+	}
+	ms.removeFromCollections(iri)
+	ms.Map.Delete(itemKey(iri))
 	return nil
 }
 
+// deleteItemCollections deletes the collections of the item, including the hidden ones of actors.
+func deleteItemCollections(ms *memStorage, it vocab.Item) {
+	for _, path := range itemCollectionPaths {
+		if prop := collectionProperty(it, path); prop != nil && !vocab.IsNil(*prop) {
+			ms.Map.Delete(itemKey((*prop).GetLink()))
+		}
+	}
+	if vocab.ActorTypes.Match(it.GetType()) {
+		ms.Map.Delete(itemKey(filters.BlockedType.IRI(it)))
+		ms.Map.Delete(itemKey(filters.IgnoredType.IRI(it)))
+	}
+}
+
+// removeFromCollections removes the "iri" item from all the collections which contain it.
+func (ms *memStorage) removeFromCollections(iri vocab.IRI) {
+	ms.Map.Range(func(key, value any) bool {
+		colIRI, ok := key.(vocab.IRI)
+		if !ok {
+			return true
+		}
+		if col, ok := value.(vocab.CollectionInterface); !ok || !col.Contains(iri) {
+			return true
+		}
+		_ = ms.RemoveFrom(colIRI, iri)
+		return true
+	})
+}
+
+func tombstone(it vocab.Item) *vocab.Tombstone {
+	t := &vocab.Tombstone{
+		ID:      it.GetLink(),
+		Type:    vocab.TombstoneType,
+		Deleted: time.Now().Truncate(time.Second).UTC(),
+	}
+	t.FormerType, _ = itemType(it)
+	return t
+}
+
 func (ms *memStorage) Create(col vocab.CollectionInterface) (vocab.CollectionInterface, error) {
 	it, err := ms.Save(col)
 	if err != nil {
@@ -162,24 +302,63 @@ func (ms *memStorage) Create(col vocab.CollectionInterface) (vocab.CollectionInt
 }
 
 func (ms *memStorage) loadCol(colIRI vocab.IRI) (vocab.CollectionInterface, error) {
-	it, ok := ms.Map.Load(colIRI)
+	it, ok := ms.Map.Load(itemKey(colIRI))
 	if !ok {
 		return nil, errors.NotFoundf("unable to load collection %s", colIRI)
 	}
+	// NOTE(marius): we return copies of the stored collections, so appending or removing items
+	// doesn't modify the values that the callers have passed to Save()
+	switch col := it.(type) {
+	case *vocab.OrderedCollection:
+		clone := *col
+		clone.OrderedItems = append(vocab.ItemCollection{}, col.OrderedItems...)
+		return &clone, nil
+	case *vocab.Collection:
+		clone := *col
+		clone.Items = append(vocab.ItemCollection{}, col.Items...)
+		return &clone, nil
+	}
 	col, ok := it.(vocab.CollectionInterface)
 	if !ok {
-		return nil, errors.Newf("invalid collection type %T %s", it, colIRI)
+		return nil, errors.BadRequestf("invalid collection type %T %s", it, colIRI)
 	}
 	return col, nil
 }
 
+// hiddenCollection builds the hidden "blocked" or "ignored" collection of an actor, which doesn't
+// exist until the first items get added to it.
+func (ms *memStorage) hiddenCollection(colIRI vocab.IRI) (vocab.CollectionInterface, error) {
+	ownerIRI, which := vocab.Split(colIRI)
+	if which != filters.BlockedType && which != filters.IgnoredType {
+		return nil, errors.NotFoundf("unable to load collection %s", colIRI)
+	}
+	owner, err := ms.Load(ownerIRI)
+	if err != nil {
+		return nil, errors.NotFoundf("unable to load owner of collection %s", colIRI)
+	}
+	if !vocab.ActorTypes.Match(owner.GetType()) {
+		return nil, errors.NotFoundf("invalid owner %s of collection %s, it is not an actor", owner.GetType(), colIRI)
+	}
+	return createNewCollection(colIRI, owner), nil
+}
+
 func (ms *memStorage) AddTo(colIRI vocab.IRI, items ...vocab.Item) error {
+	ms.colMu.Lock()
+	defer ms.colMu.Unlock()
+
 	col, err := ms.loadCol(colIRI)
+	if errors.IsNotFound(err) {
+		// NOTE(marius): the hidden collections for Blocked and Ignored items get created on demand
+		col, err = ms.hiddenCollection(colIRI)
+	}
 	if err != nil {
 		return err
 	}
 
-	if err = col.Append(items...); err != nil {
+	if oc, ok := col.(*vocab.OrderedCollection); ok {
+		// NOTE(marius): ordered collections return their most recently added items first
+		prependItems(oc, items...)
+	} else if err = col.Append(items...); err != nil {
 		return err
 	}
 
@@ -187,18 +366,67 @@ func (ms *memStorage) AddTo(colIRI vocab.IRI, items ...vocab.Item) error {
 	return err
 }
 
+// containsIRI checks if any of the items has the IRI of "it", so items which were added as IRIs
+// and as full objects are considered the same.
+func containsIRI(items vocab.ItemCollection, it vocab.Item) bool {
+	return slices.ContainsFunc(items, func(cur vocab.Item) bool {
+		return cur.GetLink().Equal(it.GetLink())
+	})
+}
+
+// prependItems adds the items which are not already in the collection at its start, in reverse order,
+// so the last of them becomes its first item.
+func prependItems(col *vocab.OrderedCollection, items ...vocab.Item) {
+	added := make(vocab.ItemCollection, 0, len(items))
+	for _, it := range slices.Backward(items) {
+		if containsIRI(col.OrderedItems, it) || containsIRI(added, it) {
+			continue
+		}
+		added = append(added, it)
+	}
+	col.OrderedItems = slices.Concat(added, col.OrderedItems)
+	col.TotalItems += uint(len(added))
+}
+
+// removeItems removes the items with the IRIs of "items" from the collection, and ignores the ones
+// which are not in it.
+func removeItems(col *vocab.OrderedCollection, items ...vocab.Item) {
+	kept := make(vocab.ItemCollection, 0, len(col.OrderedItems))
+	for _, it := range col.OrderedItems {
+		if !containsIRI(items, it) {
+			kept = append(kept, it)
+		}
+	}
+	col.TotalItems -= min(col.TotalItems, uint(len(col.OrderedItems)-len(kept)))
+	col.OrderedItems = kept
+}
+
 func (ms *memStorage) RemoveFrom(colIRI vocab.IRI, items ...vocab.Item) error {
+	ms.colMu.Lock()
+	defer ms.colMu.Unlock()
+
 	col, err := ms.loadCol(colIRI)
 	if err != nil {
 		return err
 	}
 
-	col.Remove(items...)
+	if oc, ok := col.(*vocab.OrderedCollection); ok {
+		removeItems(oc, items...)
+	} else {
+		col.Remove(items...)
+	}
 
 	_, err = ms.Save(col)
 	return err
 }
 
+func (ms *memStorage) Capabilities() Capability {
+	if ms.tombstones {
+		return CapabilitiesFull | CapabilityTombstones
+	}
+	return CapabilitiesFull
+}
+
 func clientPath(clientID string) string {
 	return filepath.Join("oauth", "clients", clientID)
 }
@@ -329,7 +557,7 @@ func (ms *memStorage) RemoveRefresh(token string) error {
 }
 
 func (ms *memStorage) LoadKey(iri vocab.IRI) (crypto.PrivateKey, error) {
-	privateKeyKey := iri.GetLink().AddPath("privateKey")
+	privateKeyKey := itemKey(iri).AddPath("privateKey")
 	prvKey, ok := ms.Map.Load(privateKeyKey)
 	if !ok {
 		return nil, errors.Errorf("unable to find private key for iri %s", iri)
@@ -338,7 +566,7 @@ func (ms *memStorage) LoadKey(iri vocab.IRI) (crypto.PrivateKey, error) {
 }
 
 func (ms *memStorage) SaveKey(iri vocab.IRI, key crypto.PrivateKey) (*vocab.PublicKey, error) {
-	privateKeyKey := iri.GetLink().AddPath("privateKey")
+	privateKeyKey := itemKey(iri).AddPath("privateKey")
 	ms.Map.Store(privateKeyKey, key)
 
 	var pub crypto.PublicKey
@@ -371,7 +599,7 @@ func (ms *memStorage) SaveKey(iri vocab.IRI, key crypto.PrivateKey) (*vocab.Publ
 }
 
 func (ms *memStorage) PasswordSet(iri vocab.IRI, pw []byte) error {
-	privateKeyKey := iri.GetLink().AddPath("__password")
+	privateKeyKey := itemKey(iri).AddPath("__password")
 	hashed, err := bcrypt.GenerateFromPassword(pw, bcrypt.MinCost)
 	if err != nil {
 		return err
@@ -381,7 +609,7 @@ func (ms *memStorage) PasswordSet(iri vocab.IRI, pw []byte) error {
 }
 
 func (ms *memStorage) PasswordCheck(iri vocab.IRI, pw []byte) error {
-	pwKey := iri.GetLink().AddPath("__password")
+	pwKey := itemKey(iri).AddPath("__password")
 	pwAny, ok := ms.Map.Load(pwKey)
 	if !ok {
 		return errors.Errorf("unable to find password for iri %s", iri)
@@ -393,7 +621,7 @@ func (ms *memStorage) PasswordCheck(iri vocab.IRI, pw []byte) error {
 }
 
 func (ms *memStorage) LoadMetadata(iri vocab.IRI, m any) error {
-	metaKey := iri.GetLink().AddPath("__meta")
+	metaKey := itemKey(iri).AddPath("__meta")
 	metaAny, ok := ms.Map.Load(metaKey)
 	if !ok {
 		return errors.Errorf("unable to find metadata for iri %s", iri)
@@ -403,7 +631,7 @@ func (ms *memStorage) LoadMetadata(iri vocab.IRI, m any) error {
 }
 
 func (ms *memStorage) SaveMetadata(iri vocab.IRI, m any) error {
-	metaKey := iri.GetLink().AddPath("__meta")
+	metaKey := itemKey(iri).AddPath("__meta")
 	ms.Map.Store(metaKey, m)
 	return nil
 }
@@ -415,6 +643,7 @@ var _ KeyStorage = &memStorage{}
 var _ OSINStorage = &memStorage{}
 var _ ClientLister = &memStorage{}
 var _ ClientSaver = &memStorage{}
+var _ Capabilities = &memStorage{}
 
 // copy copies from one instance of type T to another
 func copy[T any](from, to T) {
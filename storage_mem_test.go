@@ -1,8 +1,15 @@
 package conformance
 
 import (
+	"crypto"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/filters"
+	"github.com/openshift/osin"
 )
 
 func initStorage(_ *testing.T) ActivityPubStorage {
@@ -14,3 +21,213 @@ func Test_Conformance(t *testing.T) {
 	var suite TestType = TestActivityPub | TestKey | TestPassword | TestMetadata | TestOAuth
 	suite.Run(t, initStorage(t))
 }
+
+func Test_ConformanceWithFactory(t *testing.T) {
+	var suite TestType = TestActivityPub | TestKey | TestPassword | TestMetadata | TestOAuth
+	suite.RunWithFactory(t, initStorage)
+}
+
+func Test_ConformanceParallel(t *testing.T) {
+	var suite TestType = TestActivityPub | TestKey | TestPassword | TestMetadata | TestOAuth
+	suite.Run(t, initStorage(t), WithParallel())
+}
+
+func Test_ConformanceSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	RecordSnapshot(t, initStorage(t), path, Smoke())
+	CompareSnapshot(t, initStorage(t), path)
+}
+
+func Test_ConformanceTombstones(t *testing.T) {
+	var suite TestType = TestActivityPub
+	suite.Run(t, &memStorage{Map: new(sync.Map), tombstones: true}, Smoke())
+}
+
+var errClosed = errf("storage is closed")
+
+// closingStorage is a memStorage which rejects all the calls made after it was closed, so the tests
+// can verify that the suite doesn't close the storage before all the test groups finished.
+type closingStorage struct {
+	*memStorage
+	closed atomic.Bool
+}
+
+func (cs *closingStorage) Close() {
+	cs.closed.Store(true)
+}
+
+func (cs *closingStorage) Clone() osin.Storage {
+	return cs
+}
+
+func (cs *closingStorage) Load(i vocab.IRI, f ...filters.Check) (vocab.Item, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.Load(i, f...)
+}
+
+func (cs *closingStorage) Save(it vocab.Item) (vocab.Item, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.Save(it)
+}
+
+func (cs *closingStorage) Delete(it vocab.Item) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.Delete(it)
+}
+
+func (cs *closingStorage) AddTo(colIRI vocab.IRI, items ...vocab.Item) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.AddTo(colIRI, items...)
+}
+
+func (cs *closingStorage) RemoveFrom(colIRI vocab.IRI, items ...vocab.Item) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.RemoveFrom(colIRI, items...)
+}
+
+func (cs *closingStorage) LoadKey(iri vocab.IRI) (crypto.PrivateKey, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.LoadKey(iri)
+}
+
+func (cs *closingStorage) SaveKey(iri vocab.IRI, key crypto.PrivateKey) (*vocab.PublicKey, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.SaveKey(iri, key)
+}
+
+func (cs *closingStorage) PasswordSet(iri vocab.IRI, pw []byte) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.PasswordSet(iri, pw)
+}
+
+func (cs *closingStorage) PasswordCheck(iri vocab.IRI, pw []byte) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.PasswordCheck(iri, pw)
+}
+
+func (cs *closingStorage) LoadMetadata(iri vocab.IRI, m any) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.LoadMetadata(iri, m)
+}
+
+func (cs *closingStorage) SaveMetadata(iri vocab.IRI, m any) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.SaveMetadata(iri, m)
+}
+
+func (cs *closingStorage) SaveClient(c osin.Client) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.SaveClient(c)
+}
+
+func (cs *closingStorage) RemoveClient(id string) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.RemoveClient(id)
+}
+
+func (cs *closingStorage) ListClients() ([]osin.Client, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.ListClients()
+}
+
+func (cs *closingStorage) GetClient(id string) (osin.Client, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.GetClient(id)
+}
+
+func (cs *closingStorage) SaveAuthorize(data *osin.AuthorizeData) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.SaveAuthorize(data)
+}
+
+func (cs *closingStorage) LoadAuthorize(code string) (*osin.AuthorizeData, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.LoadAuthorize(code)
+}
+
+func (cs *closingStorage) RemoveAuthorize(code string) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.RemoveAuthorize(code)
+}
+
+func (cs *closingStorage) SaveAccess(data *osin.AccessData) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.SaveAccess(data)
+}
+
+func (cs *closingStorage) LoadAccess(token string) (*osin.AccessData, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.LoadAccess(token)
+}
+
+func (cs *closingStorage) RemoveAccess(token string) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.RemoveAccess(token)
+}
+
+func (cs *closingStorage) LoadRefresh(token string) (*osin.AccessData, error) {
+	if cs.closed.Load() {
+		return nil, errClosed
+	}
+	return cs.memStorage.LoadRefresh(token)
+}
+
+func (cs *closingStorage) RemoveRefresh(token string) error {
+	if cs.closed.Load() {
+		return errClosed
+	}
+	return cs.memStorage.RemoveRefresh(token)
+}
+
+func Test_ConformanceClosedAfterRun(t *testing.T) {
+	var suite TestType = TestActivityPub | TestKey | TestPassword | TestMetadata | TestOAuth
+	storage := &closingStorage{memStorage: &memStorage{Map: new(sync.Map)}}
+	t.Run("parallel", func(t *testing.T) {
+		suite.Run(t, storage, Smoke(), WithParallel())
+	})
+	if !storage.closed.Load() {
+		t.Errorf("the storage wasn't closed after the run")
+	}
+}
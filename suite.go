@@ -1,6 +1,16 @@
 package conformance
 
-import "testing"
+import (
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	vocab "github.com/go-ap/activitypub"
+	"github.com/go-ap/storage-conformance-suite/gen"
+)
 
 type TestType uint16
 
@@ -16,6 +26,30 @@ const (
 	TestsFull = TestActivityPub | TestKey | TestPassword | TestMetadata | TestOAuth
 )
 
+var testTypeNames = map[TestType]string{
+	TestActivityPub: "ActivityPub",
+	TestOAuth:       "OAuth2",
+	TestKey:         "Key",
+	TestPassword:    "Password",
+	TestMetadata:    "Metadata",
+}
+
+// testGroups contains the test groups in the order they get executed.
+var testGroups = []TestType{TestActivityPub, TestOAuth, TestKey, TestPassword, TestMetadata}
+
+func (tt TestType) String() string {
+	if tt == TestNone {
+		return "none"
+	}
+	names := make([]string, 0)
+	for _, g := range testGroups {
+		if tt&g == g {
+			names = append(names, testTypeNames[g])
+		}
+	}
+	return strings.Join(names, "|")
+}
+
 func Suite(tt ...TestType) TestType {
 	var result TestType = TestNone
 	for _, t := range tt {
@@ -45,39 +79,204 @@ func maybeOpen(t *testing.T, storage ActivityPubStorage) func() {
 	return func() {}
 }
 
-func (tt TestType) Run(t *testing.T, storage ActivityPubStorage) {
-	maybeClose := maybeOpen(t, storage)
-	defer maybeClose()
+// StorageFactory returns a new, ready to use, storage instance.
+// It should call t.Fatal if it's unable to build one.
+type StorageFactory func(t *testing.T) ActivityPubStorage
+
+// sharedStorage returns a StorageFactory that hands out the same storage instance every time.
+func sharedStorage(storage ActivityPubStorage) StorageFactory {
+	return func(_ *testing.T) ActivityPubStorage {
+		return storage
+	}
+}
+
+// freshStorage wraps the factory so every instance it builds gets opened,
+// and closed when the test that requested it finishes.
+func freshStorage(factory StorageFactory) StorageFactory {
+	return func(t *testing.T) ActivityPubStorage {
+		t.Helper()
+
+		storage := factory(t)
+		t.Cleanup(maybeOpen(t, storage))
+		return storage
+	}
+}
+
+// runner holds the state shared by the test groups during one execution of the suite.
+type runner struct {
+	newStorage StorageFactory
+	report     *Report
+	// strict makes failures of SHOULD requirements fail the tests, instead of only logging warnings.
+	strict bool
+	conf   config
+	rand   *rand.Rand
+	// deadline is the time after which the checks of the current test group fail without being executed.
+	deadline time.Time
+}
+
+func newRunner(newStorage StorageFactory, opts ...Option) *runner {
+	conf := newConfig(opts...)
+	return &runner{
+		newStorage: newStorage,
+		strict:     !conf.lenient,
+		conf:       conf,
+		rand:       rand.New(rand.NewPCG(conf.seed, conf.seed)),
+	}
+}
+
+// start resets the test data generator to the seed of the runner, and logs the seed if the tests fail,
+// so the run can be reproduced.
+func (r *runner) start(t *testing.T) *runner {
+	gen.Seed(r.conf.seed)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("The conformance suite ran with seed %d, rerun with %s=%d to reproduce it", r.conf.seed, SeedEnv, r.conf.seed)
+		}
+	})
+	return r
+}
+
+// forGroup returns a copy of the runner for the "tt" test group, with its own source of randomness,
+// and the deadline for the group starting now.
+func (r *runner) forGroup(tt TestType) *runner {
+	g := *r
+	g.rand = rand.New(rand.NewPCG(r.conf.seed, uint64(tt)))
+	if r.conf.timeout > 0 {
+		g.deadline = time.Now().Add(r.conf.timeout)
+	}
+	return &g
+}
+
+// partitionIRI returns the IRI an independent test stores its data for. In parallel mode every test
+// uses its own IRI, built by appending "name" to "iri", so the tests don't overwrite each other's data.
+func (r *runner) partitionIRI(iri vocab.IRI, name string) vocab.IRI {
+	if !r.conf.parallel {
+		return iri
+	}
+	return iri.AddPath(name)
+}
 
+// parallel marks the test to be run concurrently with the other parallel tests, when the parallel mode is enabled.
+//
+// NOTE(marius): all the test data must be generated before calling it, so the data generated from the same seed
+// doesn't depend on the order the tests run in.
+func (r *runner) parallel(t *testing.T) {
+	if r.conf.parallel {
+		t.Parallel()
+	}
+}
+
+// checkDeadline fails the test if the deadline of the current test group has passed.
+func (r *runner) checkDeadline(t *testing.T) {
+	t.Helper()
+
+	if !r.deadline.IsZero() && time.Now().After(r.deadline) {
+		t.Fatalf("the timeout of %s for the test group was exceeded", r.conf.timeout)
+	}
+}
+
+// withReport makes the runner record the results of all the tests it runs.
+func (r *runner) withReport(report *Report) *runner {
+	newStorage := r.newStorage
+	r.report = report
+	r.newStorage = func(t *testing.T) ActivityPubStorage {
+		storage := newStorage(t)
+		report.setBackend(storage)
+		return storage
+	}
+	return r
+}
+
+// run executes fn as the "name" subtest of t, similarly to [testing.T.Run], and records its result.
+func (r *runner) run(t *testing.T, name string, fn func(t *testing.T)) bool {
+	t.Helper()
+
+	if r.report == nil {
+		return t.Run(name, func(t *testing.T) {
+			r.checkDeadline(t)
+			fn(t)
+		})
+	}
+	return t.Run(name, func(t *testing.T) {
+		started := time.Now()
+		t.Cleanup(func() {
+			r.report.record(t, started)
+		})
+		r.checkDeadline(t)
+		fn(t)
+	})
+}
+
+// summaryOutput is where the summary table gets printed at the end of every run.
+//
+// NOTE(marius): the go test command shows the output of t.Logf only in verbose mode, or for failing tests,
+// so the summary gets written directly to the standard output, to always be shown.
+var summaryOutput io.Writer = os.Stdout
+
+// Run executes the test groups against a single storage instance, which is shared between all of them.
+// The options can change the size of the dataset, the key types, the seed and the other parameters of the run.
+func (tt TestType) Run(t *testing.T, storage ActivityPubStorage, opts ...Option) {
+	t.Helper()
+
+	// NOTE(marius): in parallel mode the test groups resume only after Run returns, so the storage
+	// can only be closed after all of them finish.
+	t.Cleanup(maybeOpen(t, storage))
+
+	tt.run(t, newRunner(sharedStorage(storage), opts...))
+}
+
+// RunWithFactory executes the test groups using a clean storage instance, built by the factory,
+// for every test group and every independent test in them.
+func (tt TestType) RunWithFactory(t *testing.T, factory StorageFactory, opts ...Option) {
+	t.Helper()
+
+	tt.run(t, newRunner(freshStorage(factory), opts...))
+}
+
+func (tt TestType) run(t *testing.T, r *runner) {
 	t.Helper()
 
 	if tt == TestNone {
 		t.Logf("No tests to run")
 		return
 	}
+
+	report := newReport()
+	r = r.withReport(report)
+	t.Cleanup(func() {
+		report.finish()
+
+		summary := strings.Builder{}
+		if err := report.WriteSummary(&summary); err == nil {
+			_, _ = io.WriteString(summaryOutput, summary.String())
+		}
+		for _, path := range reportPaths() {
+			if err := report.Save(path); err != nil {
+				t.Errorf("unable to write conformance report %s: %s", path, err)
+			}
+		}
+	})
+
+	r.start(t)
+
 	if tt&TestActivityPub == TestActivityPub {
-		t.Run("ActivityPub tests", func(t *testing.T) {
-			RunActivityPubTests(t, storage)
-		})
+		g := r.forGroup(TestActivityPub)
+		g.run(t, "ActivityPub tests", g.runActivityPubTests)
 	}
 	if tt&TestOAuth == TestOAuth {
-		t.Run("OAuth2 tests", func(t *testing.T) {
-			RunOAuthTests(t, storage)
-		})
+		g := r.forGroup(TestOAuth)
+		g.run(t, "OAuth2 tests", g.runOAuthTests)
 	}
 	if tt&TestKey == TestKey {
-		t.Run("Key tests", func(t *testing.T) {
-			RunKeyTests(t, storage)
-		})
+		g := r.forGroup(TestKey)
+		g.run(t, "Key tests", g.runKeyTests)
 	}
 	if tt&TestPassword == TestPassword {
-		t.Run("Password tests", func(t *testing.T) {
-			RunPasswordTests(t, storage)
-		})
+		g := r.forGroup(TestPassword)
+		g.run(t, "Password tests", g.runPasswordTests)
 	}
 	if tt&TestMetadata == TestMetadata {
-		t.Run("MetaData tests", func(t *testing.T) {
-			RunMetadataTests(t, storage)
-		})
+		g := r.forGroup(TestMetadata)
+		g.run(t, "MetaData tests", g.runMetadataTests)
 	}
 }
@@ -0,0 +1,176 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// ConformanceLevel summarizes how much of the suite a storage backend passes.
+type ConformanceLevel string
+
+const (
+	// ConformanceNone is the level of backends that fail some of the MUST requirements of the ActivityPub tests.
+	ConformanceNone ConformanceLevel = "none"
+	// ConformanceCore is the level of backends that pass all the MUST requirements of the ActivityPub tests.
+	ConformanceCore ConformanceLevel = "core"
+	// ConformanceSocial is the level of backends that, on top of core, pass all the MUST requirements
+	// of the Key and OAuth2 tests, which are needed for federation and for client to server interactions.
+	ConformanceSocial ConformanceLevel = "social"
+	// ConformanceFull is the level of backends that pass all the requirements of every test group,
+	// including the SHOULD and MAY ones.
+	ConformanceFull ConformanceLevel = "full"
+)
+
+// groupSummary contains the requirement outcomes for one of the test groups.
+type groupSummary struct {
+	Group    TestType
+	Passed   []string
+	Failed   []string
+	Warned   []string
+	Skipped  []string
+	mustFail bool
+}
+
+func (g groupSummary) ran() bool {
+	return len(g.Passed)+len(g.Failed)+len(g.Warned) > 0
+}
+
+// mustPass returns true if the group ran, and none of its MUST requirements failed.
+func (g groupSummary) mustPass() bool {
+	return g.ran() && !g.mustFail
+}
+
+// allPass returns true if the group ran, and none of its requirements failed or produced warnings.
+func (g groupSummary) allPass() bool {
+	return g.ran() && len(g.Failed)+len(g.Warned) == 0
+}
+
+// RequirementStatus merges the results of all the checks for the same requirement.
+// A requirement fails if any of its checks failed, it passes if at least one of them passed,
+// and it is skipped when none of its checks got executed.
+func (r *Report) RequirementStatus() map[string]Status {
+	statuses := make(map[string]Status)
+	for _, res := range r.Results {
+		if res.Requirement == "" {
+			continue
+		}
+		prev, ok := statuses[res.Requirement]
+		switch {
+		case !ok, prev == StatusSkip:
+			statuses[res.Requirement] = res.Status
+		case prev == StatusPass && res.Status != StatusSkip:
+			statuses[res.Requirement] = res.Status
+		case prev == StatusWarn && res.Status == StatusFail:
+			statuses[res.Requirement] = res.Status
+		}
+	}
+	return statuses
+}
+
+func (r *Report) summary() []groupSummary {
+	groups := make(map[TestType]*groupSummary)
+	for _, g := range testGroups {
+		groups[g] = &groupSummary{Group: g}
+	}
+	for id, st := range r.RequirementStatus() {
+		req, ok := RequirementByID(id)
+		if !ok {
+			continue
+		}
+		g, ok := groups[req.Group]
+		if !ok {
+			continue
+		}
+		switch st {
+		case StatusPass:
+			g.Passed = append(g.Passed, id)
+		case StatusFail:
+			g.Failed = append(g.Failed, id)
+		case StatusWarn:
+			g.Warned = append(g.Warned, id)
+		case StatusSkip:
+			g.Skipped = append(g.Skipped, id)
+		}
+		if req.Level == LevelMust && (st == StatusFail || st == StatusWarn) {
+			g.mustFail = true
+		}
+	}
+
+	result := make([]groupSummary, 0, len(testGroups))
+	for _, g := range testGroups {
+		gs := groups[g]
+		slices.Sort(gs.Passed)
+		slices.Sort(gs.Failed)
+		slices.Sort(gs.Warned)
+		slices.Sort(gs.Skipped)
+		result = append(result, *gs)
+	}
+	return result
+}
+
+func conformanceLevel(groups []groupSummary) ConformanceLevel {
+	byGroup := make(map[TestType]groupSummary)
+	for _, g := range groups {
+		byGroup[g.Group] = g
+	}
+	if !byGroup[TestActivityPub].mustPass() {
+		return ConformanceNone
+	}
+	if !byGroup[TestKey].mustPass() || !byGroup[TestOAuth].mustPass() {
+		return ConformanceCore
+	}
+	for _, g := range testGroups {
+		if !byGroup[g].allPass() {
+			return ConformanceSocial
+		}
+	}
+	return ConformanceFull
+}
+
+// WriteSummary writes a table with the number of passed, failed, warned and skipped requirements
+// for every test group, followed by the IDs of the failed requirements and the conformance level.
+func (r *Report) WriteSummary(w io.Writer) error {
+	groups := r.summary()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Conformance summary for %s\n", r.Backend)
+	fmt.Fprintf(tw, "GROUP\tPASS\tFAIL\tWARN\tSKIP\tSTATUS\n")
+	failed := make([]string, 0)
+	for _, g := range groups {
+		status := "ok"
+		switch {
+		case !g.ran():
+			status = "not run"
+		case len(g.Failed) > 0:
+			status = "failed"
+		case len(g.Warned) > 0:
+			status = "warnings"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", g.Group, len(g.Passed), len(g.Failed), len(g.Warned), len(g.Skipped), status)
+		failed = append(failed, g.Failed...)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		if _, err := fmt.Fprintf(w, "Failed requirements: %s\n", strings.Join(failed, ", ")); err != nil {
+			return err
+		}
+	}
+	if len(r.Limits) > 0 {
+		names := slices.Sorted(maps.Keys(r.Limits))
+		limits := make([]string, 0, len(names))
+		for _, name := range names {
+			limits = append(limits, fmt.Sprintf("%s %d", name, r.Limits[name]))
+		}
+		if _, err := fmt.Fprintf(w, "Accepted limits: %s\n", strings.Join(limits, ", ")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "Conformance level: %s\n", conformanceLevel(groups))
+	return err
+}
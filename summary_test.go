@@ -0,0 +1,90 @@
+package conformance
+
+import (
+	"strings"
+	"testing"
+)
+
+// mockResults returns a passing result for every requirement in the catalog that belongs to the "groups" test groups,
+// and has at least the "min" level.
+func mockResults(groups TestType, min Level) []Result {
+	results := make([]Result, 0)
+	for _, req := range Requirements() {
+		if groups&req.Group != req.Group || req.Level < min {
+			continue
+		}
+		results = append(results, Result{Name: req.ID, Requirement: req.ID, Level: req.Level.String(), Status: StatusPass})
+	}
+	return results
+}
+
+func TestReport_Conformance(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []Result
+		want    ConformanceLevel
+	}{
+		{
+			name:    "empty",
+			results: nil,
+			want:    ConformanceNone,
+		},
+		{
+			name:    "ActivityPub MUST",
+			results: mockResults(TestActivityPub, LevelMust),
+			want:    ConformanceCore,
+		},
+		{
+			name: "ActivityPub MUST with failure",
+			results: append(mockResults(TestActivityPub, LevelMust),
+				Result{Name: "fail", Requirement: reqAPLoad.ID, Status: StatusFail}),
+			want: ConformanceNone,
+		},
+		{
+			name:    "ActivityPub, Key and OAuth2 MUST",
+			results: mockResults(TestActivityPub|TestKey|TestOAuth, LevelMust),
+			want:    ConformanceSocial,
+		},
+		{
+			name: "everything with SHOULD warning",
+			results: append(mockResults(TestsFull, LevelMay),
+				Result{Name: "warn", Requirement: reqKeyTypes.ID, Status: StatusWarn}),
+			want: ConformanceSocial,
+		},
+		{
+			name: "everything with skipped checks",
+			results: append(mockResults(TestsFull, LevelMay),
+				Result{Name: "skip", Requirement: reqAPLoad.ID, Status: StatusSkip}),
+			want: ConformanceFull,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Report{Results: tt.results}
+			r.finish()
+			if r.Level != tt.want {
+				t.Errorf("invalid conformance level %s, expected %s", r.Level, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_WriteSummary(t *testing.T) {
+	r := &Report{
+		Backend: "*conformance.memStorage",
+		Results: append(mockResults(TestActivityPub, LevelMust),
+			Result{Name: "fail", Requirement: reqOAuthClient.ID, Status: StatusFail}),
+		Limits: map[string]int{limitContentSize: 1024, limitAttachments: 16},
+	}
+	buf := strings.Builder{}
+	if err := r.WriteSummary(&buf); err != nil {
+		t.Fatalf("unable to write summary: %s", err)
+	}
+	got := buf.String()
+	for _, want := range []string{"*conformance.memStorage", "Failed requirements: " + reqOAuthClient.ID, "Conformance level: core",
+		"Accepted limits: attachments 16, content size 1024"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary does not contain %q:\n%s", want, got)
+		}
+	}
+}
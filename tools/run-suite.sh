@@ -1,15 +1,19 @@
 #!/bin/bash
+# Runs the conformance suite against one or more storage backends.
+# The arguments can be paths to local checkouts, or git repositories which get cloned next to the suite.
 
-_repo=${1}
-_path=${_repo##*/}
+_suite=$(cd "$(dirname "${0}")/.." && pwd)
+_paths=()
 
-rm -rf ${_path}
-git clone ${_repo}
-cd ${_path}
-if [ ! -f go.work ]; then
-    go work init
-    go work use .
-    go work edit -replace github.com/go-ap/storage-conformance-suite=../storage-conformance-suite
-fi
-go mod tidy
-go test -tags conformance -cover -race -count=1 -json ./... | go run github.com/gotesttools/gotestfmt/v2/cmd/gotestfmt -showteststatus
+for _repo in "${@}"; do
+    if [ -d "${_repo}" ]; then
+        _paths+=("$(cd "${_repo}" && pwd)")
+        continue
+    fi
+    _path=$(pwd)/${_repo##*/}
+    rm -rf "${_path}"
+    git clone "${_repo}" "${_path}" || exit 1
+    _paths+=("${_path}")
+done
+
+cd "${_suite}" && go run ./cmd/conformance -suite "${_suite}" -race -parallel "${_paths[@]}"